@@ -50,3 +50,69 @@ func BenchmarkRawPLiteral(b *testing.B) {
 		}
 	})
 }
+
+// Nested struct benchmark literal.
+func BenchmarkUnmarshallNested(b *testing.B) {
+	query := url.Values{
+		"limit":  []string{"10"},
+		"page":   []string{"1"},
+		"fields": []string{"a", "b", "c"},
+		"name":   []string{"foo"},
+	}
+	type Paging struct {
+		Limit int
+		Page  int
+	}
+	type QueryStruct struct {
+		Fields []string
+		Name   string
+		Paging Paging
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data := &QueryStruct{}
+		err := Unmarshal(query, data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Straight marshal benchmark literal.
+func BenchmarkMarshal(b *testing.B) {
+	type QueryStruct struct {
+		Fields []string
+		Limit  int
+		Page   int
+	}
+	data := &QueryStruct{Fields: []string{"a", "b", "c"}, Limit: 10, Page: 1}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := Marshal(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Nested struct marshal benchmark literal.
+func BenchmarkMarshalNested(b *testing.B) {
+	type Paging struct {
+		Limit int
+		Page  int
+	}
+	type QueryStruct struct {
+		Fields []string
+		Name   string
+		Paging Paging
+	}
+	data := &QueryStruct{Fields: []string{"a", "b", "c"}, Name: "foo",
+		Paging: Paging{Limit: 10, Page: 1}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := Marshal(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package qstring
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldKind describes how a struct field maps onto query parameters
+type fieldKind int
+
+const (
+	// valueField fields are coerced from a single query parameter value
+	valueField fieldKind = iota
+	// sliceField fields hold one element per query parameter value
+	sliceField
+	// optionalField fields wrap a value or slice field in an Optional
+	optionalField
+	// nestedField fields are structs whose fields are parameters of their own
+	nestedField
+	// nestedPtrField fields are pointers to nested structs
+	nestedPtrField
+	// structSliceField fields are slices of nested structs, or pointers to
+	// them, keyed by index such as items[0][sku]
+	structSliceField
+	// mapField fields are maps keyed by strings, whose entries are keyed such
+	// as meta[color] or meta.color
+	mapField
+	// remainField fields receive the parameters not consumed by other fields
+	remainField
+)
+
+// field is the compiled plan for marshaling and unmarshaling a single struct
+// field, built once per struct type
+type field struct {
+	name  string // Go field name
+	key   string // query parameter key
+	index int
+	typ   reflect.Type
+	kind  fieldKind
+	opts  tagOptions
+
+	// embedded is set for untagged embedded structs, whose fields are promoted
+	// into the key space of the parent struct whatever the nesting style
+	embedded bool
+
+	// keys holds the key followed by any aliases accepted when unmarshaling,
+	// in order of precedence
+	keys []string
+
+	// defaults holds the default query parameter values for the field, split
+	// on "|" for slice fields
+	defaults []string
+
+	// rules holds the validation options declared for the field, while err
+	// records a tag whose options could not be compiled
+	rules []rule
+	err   error
+
+	// coerce and format convert the field to and from a single query
+	// parameter value, while elemCoerce and elemFormat do the same for the
+	// elements of slice fields
+	coerce     coerceFunc
+	format     formatFunc
+	elemCoerce coerceFunc
+	elemFormat formatFunc
+
+	// value holds the plan for the Value of an Optional field, or for the
+	// values of a map field
+	value *field
+}
+
+// structFields holds the compiled field plans for a struct type
+type structFields struct {
+	list []field
+
+	// validator and marshaller record whether pointers to the struct implement
+	// Validator and Marshaller respectively
+	validator  bool
+	marshaller bool
+}
+
+// typeCache holds the field plans compiled for each struct type, along with
+// whether each type has a remain field, for a given tag name and key naming
+type typeCache struct {
+	fields sync.Map // map[reflect.Type]*structFields
+	remain sync.Map // map[reflect.Type]bool
+}
+
+// defaultCache is shared by every Decoder and Encoder which derives keys in the
+// default manner
+var defaultCache typeCache
+
+// typeCache returns the field cache for the options
+func (o *options) typeCache() *typeCache {
+	if o.cache == nil {
+		return &defaultCache
+	}
+	return o.cache
+}
+
+// cachedTypeFields returns the compiled field plans for the provided struct
+// type, building them only on first use
+func (o *options) cachedTypeFields(t reflect.Type) *structFields {
+	cache := o.typeCache()
+	if fields, ok := cache.fields.Load(t); ok {
+		return fields.(*structFields)
+	}
+	fields, _ := cache.fields.LoadOrStore(t, typeFields(t, o))
+	return fields.(*structFields)
+}
+
+// typeFields compiles the field plans for the provided struct type, omitting
+// unexported fields and those whose tag instructs them to be ignored
+func typeFields(t reflect.Type, o *options) *structFields {
+	pt := reflect.PtrTo(t)
+	fields := &structFields{
+		validator:  pt.Implements(validatorType),
+		marshaller: pt.Implements(marshallerType),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		typField := t.Field(i)
+		if typField.PkgPath != "" {
+			continue
+		}
+
+		name, opts := parseTagOptions(o.tag(typField.Tag))
+		if name == "-" {
+			continue
+		}
+		embedded := typField.Anonymous && name == "" && !opts.prefix
+		if name == "" {
+			// resolvable fields must have at least the `flag` struct tag
+			name = o.key(typField.Name)
+		}
+
+		f := field{
+			name:  typField.Name,
+			key:   name,
+			index: i,
+			typ:   typField.Type,
+			opts:  opts,
+			keys:  []string{name},
+
+			embedded: embedded,
+		}
+		if opts.alias != "" {
+			f.keys = append(f.keys, strings.Split(opts.alias, "|")...)
+		}
+		f.compile()
+
+		if opts.hasDefault {
+			if valueType(f.typ).Kind() == reflect.Slice {
+				f.defaults = strings.Split(opts.def, "|")
+			} else {
+				f.defaults = []string{opts.def}
+			}
+		}
+
+		if f.kind == mapField {
+			// the validation options of a map apply to each of its entries
+			f.value.rules, f.err = compileRules(f.value.typ, opts, f.value.isSlice())
+		} else {
+			f.rules, f.err = compileRules(f.typ, opts, f.isSlice())
+		}
+		if f.err != nil {
+			f.err = fmt.Errorf("%v (field %s.%s)", f.err, t, typField.Name)
+		}
+		fields.list = append(fields.list, f)
+	}
+	return fields
+}
+
+// compile determines the kind of the field along with the functions used to
+// coerce and format its values
+func (f *field) compile() {
+	t := f.typ
+	f.coerce, f.format = newCoerceFunc(t), newFormatFunc(t)
+	switch {
+	case f.opts.remain && isRemainField(t):
+		f.kind = remainField
+	case isOptional(t):
+		f.kind = optionalField
+		f.value = &field{name: f.name, key: f.key, typ: t.Field(optionalValue).Type, opts: f.opts}
+		f.value.compile()
+	case isNestedStruct(t):
+		f.kind = nestedField
+	case t.Kind() == reflect.Ptr && isNestedStruct(t.Elem()):
+		f.kind = nestedPtrField
+	case isMapField(t):
+		f.kind = mapField
+		f.value = &field{name: f.name, key: f.key, typ: t.Elem(), opts: f.opts}
+		f.value.compile()
+	case t.Kind() == reflect.Slice && isNestedStruct(indirectType(t.Elem())):
+		f.kind = structSliceField
+		f.elemCoerce, f.elemFormat = newCoerceFunc(t.Elem()), newFormatFunc(t.Elem())
+	case t.Kind() == reflect.Slice && !isQueryValue(t):
+		f.kind = sliceField
+		f.elemCoerce, f.elemFormat = newCoerceFunc(t.Elem()), newFormatFunc(t.Elem())
+	default:
+		f.kind = valueField
+	}
+}
+
+// isSlice returns true if the field, or the Value of an Optional field, is
+// compiled to be coerced from each of its query parameter values
+func (f *field) isSlice() bool {
+	if f.kind == optionalField {
+		f = f.value
+	}
+	return f.kind == sliceField
+}
+
+// kindFor returns the kind of the field for the provided options. A field whose
+// type has a registered converter is always treated as a single value, while a
+// slice of structs whose element type has one is treated as any other slice
+func (f *field) kindFor(o *options) fieldKind {
+	switch f.kind {
+	case valueField, remainField, optionalField:
+		return f.kind
+	}
+	if o.hasConverters() {
+		if _, ok := o.converter(indirectType(f.typ)); ok {
+			return valueField
+		}
+		if f.kind == structSliceField {
+			if _, ok := o.converter(indirectType(f.typ.Elem())); ok {
+				return sliceField
+			}
+		}
+	}
+	return f.kind
+}
+
+// hasRemain reports whether the provided struct type, or any struct nested
+// within it, has a remain field
+func (o *options) hasRemain(t reflect.Type) bool {
+	cache := o.typeCache()
+	if r, ok := cache.remain.Load(t); ok {
+		return r.(bool)
+	}
+	r := o.findRemain(t, make(map[reflect.Type]bool))
+	cache.remain.Store(t, r)
+	return r
+}
+
+func (o *options) findRemain(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+
+	for _, f := range o.cachedTypeFields(t).list {
+		switch {
+		case f.kind == remainField,
+			f.kind == nestedField && o.findRemain(f.typ, visited),
+			f.kind == nestedPtrField && o.findRemain(f.typ.Elem(), visited):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package qstring
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCachedTypeFields(t *testing.T) {
+	type Paging struct {
+		Page int
+	}
+	type Query struct {
+		Name    string   `qstring:"q,omitempty"`
+		Limit   int      `qstring:",default=25"`
+		Sort    []string `qstring:"sort,default=name|-created"`
+		Paging  Paging
+		Cursor  *Paging
+		Filter  Optional[string]
+		Ignored string `qstring:"-"`
+		private string
+	}
+
+	expected := []struct {
+		name     string
+		key      string
+		kind     fieldKind
+		defaults []string
+	}{
+		{"Name", "q", valueField, nil},
+		{"Limit", "limit", valueField, []string{"25"}},
+		{"Sort", "sort", sliceField, []string{"name", "-created"}},
+		{"Paging", "paging", nestedField, nil},
+		{"Cursor", "cursor", nestedPtrField, nil},
+		{"Filter", "filter", optionalField, nil},
+	}
+
+	typ := reflect.TypeOf(Query{})
+	fields := defaultDecoder.opts.cachedTypeFields(typ)
+	if len(fields.list) != len(expected) {
+		t.Fatalf("Expected %d fields, got %d", len(expected), len(fields.list))
+	}
+	for i, f := range fields.list {
+		exp := expected[i]
+		if f.name != exp.name || f.key != exp.key || f.kind != exp.kind ||
+			!reflect.DeepEqual(f.defaults, exp.defaults) {
+			t.Errorf("Expected field %+v, got name %s key %s kind %d defaults %v",
+				exp, f.name, f.key, f.kind, f.defaults)
+		}
+	}
+
+	if again := defaultDecoder.opts.cachedTypeFields(typ); again != fields {
+		t.Errorf("Expected fields to be cached between calls")
+	}
+}
@@ -1,11 +1,14 @@
 package qstring
 
 import (
+	"encoding"
+	"errors"
+	"math"
 	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
-	"time"
 )
 
 // Unmarshaller defines the interface for performing custom unmarshalling of
@@ -14,12 +17,88 @@ type Unmarshaller interface {
 	UnmarshalQuery(url.Values) error
 }
 
+// QueryValueUnmarshaler defines the interface for types which unmarshal
+// themselves from a single query parameter value. It is honoured for struct
+// fields and the elements of slice fields, and takes precedence over
+// encoding.TextUnmarshaler
+type QueryValueUnmarshaler interface {
+	UnmarshalQueryValue(string) error
+}
+
+// Validator defines the interface for performing validation of a struct, such
+// as checks spanning several fields, once its fields have been unmarshalled.
+// It is called on the destination struct and on each nested struct
+type Validator interface {
+	ValidateQuery() error
+}
+
 // Unmarshal unmarshalls the provided url.Values (query string) into the
 // interface provided
 func Unmarshal(data url.Values, v interface{}) error {
+	return defaultDecoder.Unmarshal(data, v)
+}
+
+// UnmarshalAll behaves like Unmarshal, but rather than stopping at the first
+// field that fails to unmarshal it decodes every field and returns all of the
+// failures as DecodeErrors
+func UnmarshalAll(data url.Values, v interface{}) error {
+	return collectingDecoder.Unmarshal(data, v)
+}
+
+var (
+	defaultDecoder    = NewDecoder()
+	collectingDecoder = NewDecoder(CollectErrors())
+)
+
+// A Decoder unmarshals query strings into structs according to the options it
+// was created with. A Decoder is safe for concurrent use by multiple
+// goroutines, allowing it to be configured once and shared
+type Decoder struct {
+	opts options
+}
+
+// NewDecoder returns a new Decoder configured with the provided options
+func NewDecoder(opts ...Option) *Decoder {
+	dec := &Decoder{}
+	dec.opts.apply(opts)
+	return dec
+}
+
+// Unmarshal unmarshalls the provided url.Values (query string) into the
+// interface provided
+func (dec *Decoder) Unmarshal(data url.Values, v interface{}) error {
+	_, err := dec.UnmarshalWithWarnings(data, v)
+	return err
+}
+
+// UnmarshalWithWarnings behaves like Unmarshal, additionally returning each of
+// the deprecated parameters present in the query string, such that they may be
+// reported to the client through Warning or Deprecation headers
+func (dec *Decoder) UnmarshalWithWarnings(data url.Values, v interface{}) ([]Deprecation, error) {
 	var d decoder
-	d.init(data)
-	return d.unmarshal(v)
+	d.init(data, &dec.opts)
+	err := d.unmarshal(v)
+	if fn := dec.opts.onDeprecated; fn != nil {
+		for _, dep := range d.deprecations {
+			fn(dep)
+		}
+	}
+	return d.deprecations, err
+}
+
+// A Deprecation describes a query parameter, provided in a query string, for a
+// field tagged with the deprecated option
+type Deprecation struct {
+	Key     string // query parameter key, which may be one of the field's aliases
+	Field   string // Go field path
+	Message string // message provided with the deprecated option, if any
+}
+
+func (d Deprecation) String() string {
+	if d.Message == "" {
+		return "parameter " + strconv.Quote(d.Key) + " is deprecated"
+	}
+	return "parameter " + strconv.Quote(d.Key) + " is deprecated: " + d.Message
 }
 
 // An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
@@ -39,147 +118,931 @@ func (e InvalidUnmarshalError) Error() string {
 	return "qstring: Unmarshal(nil " + e.Type.String() + ")"
 }
 
+// An UnmarshalTypeError describes a query parameter value that could not be
+// coerced into the type of the struct field it was destined for.
+type UnmarshalTypeError struct {
+	Key   string       // query parameter key
+	Field string       // Go field path, e.g. "PageInfo.Limit" or "IDs[1]"
+	Type  reflect.Type // type of the value being coerced
+	Value string       // raw query parameter value
+	Err   error        // underlying parse error
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return "qstring: cannot unmarshal " + strconv.Quote(e.Value) + " into " +
+		e.Field + " of type " + e.Type.String() + " (parameter " +
+		strconv.Quote(e.Key) + "): " + e.Err.Error()
+}
+
+// Unwrap returns the underlying parse error
+func (e *UnmarshalTypeError) Unwrap() error {
+	return e.Err
+}
+
+// ErrRepeatedKey is wrapped by the UnmarshalTypeError returned by a Decoder
+// created with the DisallowRepeatedKeys option when a single valued field's
+// parameter is provided more than once
+var ErrRepeatedKey = errors.New("parameter provided more than once")
+
+// A LimitError describes a query string which exceeds one of the limits
+// configured on a Decoder
+type LimitError struct {
+	Key   string // query parameter key, empty for limits on the whole query
+	Limit string // description of the limit, e.g. "slice length"
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	if e.Key == "" {
+		return "qstring: query string exceeds the maximum " + e.Limit + " of " +
+			strconv.Itoa(e.Max)
+	}
+	return "qstring: parameter " + strconv.Quote(e.Key) + " exceeds the maximum " +
+		e.Limit + " of " + strconv.Itoa(e.Max)
+}
+
+// An UnknownKeysError lists the query parameters which do not map to any field
+// of the struct being unmarshalled
+type UnknownKeysError struct {
+	Keys []string
+}
+
+func (e *UnknownKeysError) Error() string {
+	return "qstring: unknown query parameters " + quoteKeys(e.Keys)
+}
+
+// A MissingParameterError lists the query parameters of fields tagged with the
+// required option which were absent from the query string
+type MissingParameterError struct {
+	Keys []string
+}
+
+func (e *MissingParameterError) Error() string {
+	return "qstring: missing required query parameters " + quoteKeys(e.Keys)
+}
+
+// quoteKeys formats a list of query parameter keys for use in error messages
+func quoteKeys(keys []string) string {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = strconv.Quote(key)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// A ValidationError wraps an error returned by the ValidateQuery method of
+// the destination struct or one of its nested structs
+type ValidationError struct {
+	Field string // Go field path of the nested struct, empty for the root
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return "qstring: validation failed: " + e.Err.Error()
+	}
+	return "qstring: validation of " + e.Field + " failed: " + e.Err.Error()
+}
+
+// Unwrap returns the error returned by ValidateQuery
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeErrors holds every error encountered by a Decoder configured to
+// collect errors rather than stop at the first failure
+type DecodeErrors []error
+
+func (e DecodeErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the individual errors so that errors.Is and errors.As match
+// against each of them
+func (e DecodeErrors) Unwrap() []error {
+	return e
+}
+
 type decoder struct {
-	data url.Values
+	data    url.Values
+	opts    *options
+	errs    DecodeErrors
+	known   map[string]struct{}
+	folded  map[string][]string
+	found   int
+	missing []string
+	remain  reflect.Value
+
+	// remainPtrs holds the nil pointers, along with the structs allocated for
+	// them, through which the remain field is reached. They are only set
+	// should there be leftover parameters for the remain field to receive
+	remainPtrs [][2]reflect.Value
+
+	// types holds the struct types being decoded along the current path which
+	// were allocated by the decoder, or are the destination itself
+	types []reflect.Type
+
+	// elements counts the struct slice elements being decoded along the
+	// current path, within which remain fields are ignored
+	elements int
+
+	deprecations []Deprecation
 }
 
-func (d *decoder) init(data url.Values) *decoder {
+func (d *decoder) init(data url.Values, opts *options) *decoder {
 	d.data = data
+	d.opts = opts
 	return d
 }
 
+// lookup returns the key and values provided for the field's query parameter,
+// recording that each of its keys is recognised by the destination struct when
+// tracking keys. The key takes precedence over the aliases, which take
+// precedence over each other in the order they were declared. When keys are
+// case insensitive, an exact match takes precedence over any other
+func (d *decoder) lookup(f *field, prefix string) (string, []string, bool) {
+	var found string
+	var query []string
+	var ok bool
+	for _, key := range f.keys {
+		key = d.opts.nestKey(prefix, key)
+		d.recognise(key)
+		if q, exists := d.data[key]; exists && !ok {
+			found, query, ok = key, q, true
+		}
+	}
+
+	if d.opts.caseInsensitiveKeys {
+		for _, key := range f.keys {
+			for _, k := range d.foldedKeys(d.opts.nestKey(prefix, key)) {
+				d.recognise(k)
+				if !ok {
+					found, query, ok = k, d.data[k], true
+				}
+			}
+		}
+	}
+
+	if ok {
+		d.found++
+	}
+	return found, query, ok
+}
+
+// recognise records that the query parameter key maps to a field of the
+// destination struct when tracking keys
+func (d *decoder) recognise(key string) {
+	if d.known != nil {
+		d.known[key] = struct{}{}
+	}
+}
+
+// foldedKeys returns the query parameter keys which match the provided key
+// regardless of case, in sorted order
+func (d *decoder) foldedKeys(key string) []string {
+	if d.folded == nil {
+		d.folded = make(map[string][]string, len(d.data))
+		for k := range d.data {
+			folded := strings.ToLower(k)
+			d.folded[folded] = append(d.folded[folded], k)
+		}
+		for _, keys := range d.folded {
+			sort.Strings(keys)
+		}
+	}
+	return d.folded[strings.ToLower(key)]
+}
+
+// setRemain assigns every query parameter that no other field consumed to the
+// field tagged with the remain option
+func (d *decoder) setRemain() {
+	keys := d.unknownKeys()
+	if len(keys) == 0 {
+		return
+	}
+
+	remain := make(url.Values, len(keys))
+	for _, key := range keys {
+		remain[key] = append([]string(nil), d.data[key]...)
+	}
+	d.remain.Set(reflect.ValueOf(remain).Convert(d.remain.Type()))
+	for _, ptr := range d.remainPtrs {
+		ptr[0].Set(ptr[1])
+	}
+}
+
+// unknownKeys returns the sorted query parameter keys that were never looked
+// up while decoding
+func (d *decoder) unknownKeys() []string {
+	var keys []string
+	for key := range d.data {
+		if _, ok := d.known[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fail reports an error for a single field. When collecting errors the error
+// is recorded and nil returned so that decoding carries on
+func (d *decoder) fail(err error) error {
+	if d.opts.collectErrors {
+		d.errs = append(d.errs, err)
+		return nil
+	}
+	return err
+}
+
 func (d *decoder) unmarshal(v interface{}) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return &InvalidUnmarshalError{reflect.TypeOf(v)}
 	}
 
+	if max := d.opts.maxParams; max > 0 && len(d.data) > max {
+		return &LimitError{Limit: "number of parameters", Max: max}
+	}
+
 	switch val := v.(type) {
 	case Unmarshaller:
 		return val.UnmarshalQuery(d.data)
 	default:
-		return d.value(rv)
+		// keys are only tracked when the leftovers are of interest
+		if d.opts.disallowUnknownKeys || d.opts.hasRemain(rv.Type().Elem()) {
+			d.known = make(map[string]struct{}, len(d.data))
+		}
+		d.types = append(d.types, rv.Type().Elem())
+		if err := d.value(rv, "", ""); err != nil {
+			return err
+		}
+	}
+
+	if len(d.missing) > 0 {
+		if err := d.fail(&MissingParameterError{Keys: d.missing}); err != nil {
+			return err
+		}
+	}
+
+	if d.remain.IsValid() {
+		d.setRemain()
+	} else if d.opts.disallowUnknownKeys {
+		if keys := d.unknownKeys(); len(keys) > 0 {
+			if err := d.fail(&UnknownKeysError{Keys: keys}); err != nil {
+				return err
+			}
+		}
 	}
+
+	if len(d.errs) > 0 {
+		return d.errs
+	}
+	return nil
 }
 
-func (d *decoder) value(val reflect.Value) error {
+// value decodes the fields of the struct pointed at by val, whose Go field path
+// is path and whose fields' keys are nested within the key prefix
+func (d *decoder) value(val reflect.Value, path, prefix string) error {
 	var err error
+	nerrs, nmissing := len(d.errs), len(d.missing)
 	elem := val.Elem()
-	typ := elem.Type()
+	fields := d.opts.cachedTypeFields(elem.Type())
 
-	for i := 0; i < elem.NumField(); i++ {
-		// pull out the qstring struct tag
-		elemField := elem.Field(i)
-		typField := typ.Field(i)
-		qstring, _ := parseTag(typField.Tag.Get(Tag))
-		if qstring == "" {
-			// resolvable fields must have at least the `flag` struct tag
-			qstring = strings.ToLower(typField.Name)
+	for i := range fields.list {
+		f := &fields.list[i]
+		if f.err != nil {
+			return f.err
 		}
+		elemField := elem.Field(f.index)
 
-		// determine if this is an unsettable field or was explicitly set to be
-		// ignored
-		if !elemField.CanSet() || qstring == "-" {
+		switch f.kindFor(d.opts) {
+		case remainField:
+			// the first remain field receives any leftover parameters once
+			// every other field has been decoded, those within slice
+			// elements are ignored
+			if !d.remain.IsValid() && d.elements == 0 {
+				d.remain = elemField
+			}
+			continue
+		case nestedField:
+			err = d.value(elemField.Addr(), joinPath(path, f.name), d.opts.nestedPrefix(prefix, f))
+			if err != nil {
+				return err
+			}
+			continue
+		case nestedPtrField:
+			err = d.nestedPtr(elemField, joinPath(path, f.name), prefix, d.opts.nestedPrefix(prefix, f))
+			if err != nil {
+				return err
+			}
+			continue
+		case structSliceField:
+			if err = d.structSlice(f, path, prefix, elemField); err != nil {
+				return err
+			}
+			continue
+		case mapField:
+			if err = d.mapField(f, path, prefix, elemField); err != nil {
+				return err
+			}
 			continue
 		}
 
-		// only do work if the current fields query string parameter was provided
-		if query, ok := d.data[qstring]; ok {
-			switch k := typField.Type.Kind(); k {
-			case reflect.Slice:
-				err = d.coerceSlice(query, k, elemField)
-			default:
-				err = d.coerce(query[0], k, elemField)
+		// only do work if the current fields query string parameter was
+		// provided, falling back to any default declared in its tag
+		key := d.opts.nestKey(prefix, f.key)
+		found, query, ok := d.lookup(f, prefix)
+		if ok {
+			d.deprecate(f, found, path)
+		}
+		target, dest := f, elemField
+		if !ok {
+			if f.opts.required {
+				d.missing = append(d.missing, key)
+				continue
 			}
-		} else if typField.Type.Kind() == reflect.Struct {
-			if elemField.CanAddr() {
-				err = d.value(elemField.Addr())
+			if !f.opts.hasDefault {
+				continue
 			}
+			query = f.defaults
+			if f.kindFor(d.opts) == optionalField {
+				// a default only provides the Value of an Optional, which
+				// remains unset as its parameter was absent
+				target, dest = f.value, elemField.Field(optionalValue)
+			}
+		}
+		if sep := d.opts.delimiter(f); sep != "" && d.isSlice(f) {
+			query = splitValues(query, sep)
+		}
+
+		err = d.field(target, key, path, query, dest)
+		if err == nil {
+			err = validate(f.rules, d.isSlice(f), key, joinPath(path, f.name), query, elemField)
 		}
 		if err != nil {
-			return err
+			if err = d.fail(err); err != nil {
+				return err
+			}
 		}
 	}
+
+	// only run the validation hook once every field was decoded successfully
+	if !fields.validator || len(d.errs) != nerrs || len(d.missing) != nmissing {
+		return nil
+	}
+	if err = val.Interface().(Validator).ValidateQuery(); err != nil {
+		return d.fail(&ValidationError{Field: path, Err: err})
+	}
 	return nil
 }
 
-// coerce converts the provided query parameter slice into the proper type for
-// the target field. this coerced value is then assigned to the current field
-func (d *decoder) coerce(query string, target reflect.Kind, field reflect.Value) error {
-	var err error
-	var c interface{}
+// nestedPtr decodes a pointer to a nested struct, whose fields' keys are nested
+// within prefix while those of its parent are nested within parent. A nil
+// pointer is only allocated if at least one of the nested struct's query
+// parameters was provided, so that its absence can be distinguished from its
+// zero value
+func (d *decoder) nestedPtr(field reflect.Value, path, parent, prefix string) error {
+	if !field.IsNil() {
+		return d.value(field, path, prefix)
+	}
 
-	switch target {
-	case reflect.String:
-		field.SetString(query)
-	case reflect.Bool:
-		c, err = strconv.ParseBool(query)
-		if err == nil {
-			field.SetBool(c.(bool))
+	// a struct which points to its own type would otherwise be allocated
+	// endlessly. When its keys are nested it is only descended into if a key
+	// is nested within its prefix, otherwise only if its type is not already
+	// being decoded along the current path
+	typ := field.Type().Elem()
+	if prefix != parent {
+		if !d.hasKeyWithin(prefix) {
+			return nil
 		}
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		c, err = strconv.ParseInt(query, 10, 64)
-		if err == nil {
-			field.SetInt(c.(int64))
+	} else {
+		for _, t := range d.types {
+			if t == typ {
+				return nil
+			}
 		}
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		c, err = strconv.ParseUint(query, 10, 64)
-		if err == nil {
-			field.SetUint(c.(uint64))
+	}
+
+	d.types = append(d.types, typ)
+	defer func() { d.types = d.types[:len(d.types)-1] }()
+
+	nerrs, nmissing, nfound := len(d.errs), len(d.missing), d.found
+	hadRemain := d.remain.IsValid()
+	ptr := reflect.New(typ)
+	err := d.value(ptr, path, prefix)
+	if d.found == nfound {
+		// discard any complaints about a struct that was never provided,
+		// keeping hold of it if it holds the remain field
+		d.errs, d.missing = d.errs[:nerrs], d.missing[:nmissing]
+		if !hadRemain && d.remain.IsValid() {
+			d.remainPtrs = append(d.remainPtrs, [2]reflect.Value{field, ptr})
 		}
-	case reflect.Float32, reflect.Float64:
-		c, err = strconv.ParseFloat(query, 64)
-		if err == nil {
-			field.SetFloat(c.(float64))
+		return nil
+	}
+
+	field.Set(ptr)
+	return err
+}
+
+// hasKeyWithin returns true if any query parameter key is nested within the
+// key prefix, such as page[size] or page.size for page
+func (d *decoder) hasKeyWithin(prefix string) bool {
+	n := len(prefix)
+	for k := range d.data {
+		if len(k) <= n+1 {
+			continue
+		}
+		if d.opts.caseInsensitiveKeys {
+			if !strings.EqualFold(k[:n], prefix) {
+				continue
+			}
+		} else if k[:n] != prefix {
+			continue
 		}
-	case reflect.Struct:
-		// unescape the query parameter before attempting to parse it
-		query, err = url.QueryUnescape(query)
+
+		rest := k[n:]
+		if rest[0] == '[' || strings.HasPrefix(rest, ".") ||
+			(d.opts.separator != "" && strings.HasPrefix(rest, d.opts.separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// structSlice decodes a slice of structs from indexed keys such as
+// items[0][sku]. The indices provided are compacted, in ascending order, into
+// the elements of a new slice, so that items[0] and items[5] produce a slice
+// of two elements
+func (d *decoder) structSlice(f *field, path, prefix string, v reflect.Value) error {
+	key, indices := d.indices(f, prefix)
+	if len(indices) == 0 {
+		if f.opts.required {
+			d.missing = append(d.missing, key)
+		}
+		return nil
+	}
+	if max := d.opts.sliceIndexLimit(); indices[len(indices)-1] > max {
+		return d.fail(&LimitError{Key: key, Limit: "slice index", Max: max})
+	}
+	if max := d.opts.maxSliceLen; max > 0 && len(indices) > max {
+		return d.fail(&LimitError{Key: key, Limit: "slice length", Max: max})
+	}
+
+	d.deprecate(f, key, path)
+	path = joinPath(path, f.name)
+	slice := reflect.MakeSlice(f.typ, len(indices), len(indices))
+	for i, index := range indices {
+		elem := slice.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		} else {
+			elem = elem.Addr()
+		}
+
+		elemPath := path + "[" + strconv.Itoa(i) + "]"
+		d.types = append(d.types, elem.Type().Elem())
+		d.elements++
+		err := d.value(elem, elemPath, indexKey(key, index))
+		d.elements--
+		d.types = d.types[:len(d.types)-1]
 		if err != nil {
 			return err
 		}
+	}
+	v.Set(slice)
+	return nil
+}
 
-		switch field.Interface().(type) {
-		case time.Time:
-			var t time.Time
-			t, err = time.Parse(time.RFC3339, query)
-			if err == nil {
-				field.Set(reflect.ValueOf(t))
+// indices returns the key of the slice of structs described by f along with
+// the distinct indices, in ascending order, of the indexed keys provided for
+// it. The key and then each of the aliases are tried until indices are found
+func (d *decoder) indices(f *field, prefix string) (string, []int) {
+	for _, key := range f.keys {
+		key = d.opts.nestKey(prefix, key)
+
+		var indices []int
+		for k := range d.data {
+			if index, ok := d.parseIndex(k, key); ok {
+				indices = append(indices, index)
 			}
-		case ComparativeTime:
-			t := *NewComparativeTime()
-			err = t.Parse(query)
-			if err == nil {
-				field.Set(reflect.ValueOf(t))
+		}
+		if len(indices) == 0 {
+			continue
+		}
+
+		sort.Ints(indices)
+		n := 1
+		for _, index := range indices[1:] {
+			if index != indices[n-1] {
+				indices[n] = index
+				n++
 			}
-		default:
-			d.value(field)
 		}
+		return key, indices[:n]
 	}
+	return d.opts.nestKey(prefix, f.key), nil
+}
 
-	return err
+// parseIndex returns the index of the query parameter key k if it is an
+// indexed key of the slice keyed key, such as items[0][sku] for items. Indices
+// must be written without leading zeros, and those too large to be represented
+// are returned as math.MaxInt so that they exceed any limit
+func (d *decoder) parseIndex(k, key string) (int, bool) {
+	n := len(key)
+	if len(k) < n+3 || k[n] != '[' {
+		return 0, false
+	}
+	if d.opts.caseInsensitiveKeys {
+		if !strings.EqualFold(k[:n], key) {
+			return 0, false
+		}
+	} else if k[:n] != key {
+		return 0, false
+	}
+
+	end := strings.IndexByte(k[n+1:], ']')
+	if end <= 0 {
+		return 0, false
+	}
+	digits := k[n+1 : n+1+end]
+	if digits[0] == '0' && len(digits) > 1 {
+		return 0, false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+
+	index, err := strconv.Atoi(digits)
+	if err != nil {
+		return math.MaxInt, true
+	}
+	return index, true
+}
+
+// mapField decodes a map keyed by strings from the parameters keyed such as
+// meta[color] or meta.color, with the separator of DottedNesting accepted in
+// place of the dot. Should an entry be provided more than once, the bracketed
+// form takes precedence, followed by keys matching the case of the field's key
+func (d *decoder) mapField(f *field, path, prefix string, v reflect.Value) error {
+	key := d.opts.nestKey(prefix, f.key)
+	var entries []mapEntry
+	for k := range d.data {
+		if name, bracketed, ok := d.parseMapKey(k, key); ok {
+			d.recognise(k)
+			entries = append(entries, mapEntry{
+				name:      name,
+				key:       k,
+				bracketed: bracketed,
+				exact:     strings.HasPrefix(k, key),
+			})
+		}
+	}
+
+	if len(entries) == 0 {
+		if f.opts.required {
+			d.missing = append(d.missing, key)
+		}
+		return nil
+	}
+	d.found++
+	d.deprecate(f, key, path)
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].before(entries[j])
+	})
+	m := reflect.MakeMapWithSize(f.typ, len(entries))
+	for i, entry := range entries {
+		if i > 0 && entry.name == entries[i-1].name {
+			continue
+		}
+
+		name, k := entry.name, entry.key
+		query := d.data[k]
+		if sep := d.opts.delimiter(f); sep != "" && d.isSlice(f.value) {
+			query = splitValues(query, sep)
+		}
+
+		// the entry is named in errors as though it were a field of its own
+		value := *f.value
+		value.name += "[" + strconv.Quote(name) + "]"
+
+		elem := reflect.New(f.typ.Elem()).Elem()
+		err := d.field(&value, k, path, query, elem)
+		if err == nil {
+			err = validate(value.rules, d.isSlice(&value), k, joinPath(path, value.name), query, elem)
+		}
+		if err != nil {
+			if err = d.fail(err); err != nil {
+				return err
+			}
+			continue
+		}
+		m.SetMapIndex(reflect.ValueOf(name).Convert(f.typ.Key()), elem)
+	}
+	v.Set(m)
+	return nil
+}
+
+// deprecate records the use of key, provided for the field described by f, if
+// the field is tagged deprecated
+func (d *decoder) deprecate(f *field, key, path string) {
+	if f.opts.deprecated {
+		d.deprecations = append(d.deprecations, Deprecation{
+			Key:     key,
+			Field:   joinPath(path, f.name),
+			Message: f.opts.deprecation,
+		})
+	}
+}
+
+// mapEntry describes a query parameter providing an entry of a map field
+type mapEntry struct {
+	name      string // name of the map entry
+	key       string // query parameter key
+	bracketed bool   // whether the key is of the form meta[color]
+	exact     bool   // whether the key matches the case of the field's key
+}
+
+// before orders map entries by name, followed by their precedence
+func (e mapEntry) before(o mapEntry) bool {
+	switch {
+	case e.name != o.name:
+		return e.name < o.name
+	case e.bracketed != o.bracketed:
+		return e.bracketed
+	case e.exact != o.exact:
+		return e.exact
+	}
+	return e.key < o.key
+}
+
+// parseMapKey returns the name of the map entry keyed by the query parameter
+// key k if it is an entry of the map keyed key, such as color for meta[color]
+// or meta.color, and whether the bracketed form was used
+func (d *decoder) parseMapKey(k, key string) (string, bool, bool) {
+	n := len(key)
+	if len(k) < n+2 {
+		return "", false, false
+	}
+	if d.opts.caseInsensitiveKeys {
+		if !strings.EqualFold(k[:n], key) {
+			return "", false, false
+		}
+	} else if k[:n] != key {
+		return "", false, false
+	}
+
+	rest := k[n:]
+	if rest[0] == '[' {
+		if end := strings.IndexByte(rest, ']'); end == len(rest)-1 && end > 1 {
+			return rest[1:end], true, true
+		}
+		return "", false, false
+	}
+	for _, sep := range [...]string{".", d.opts.separator} {
+		if sep != "" && len(rest) > len(sep) && strings.HasPrefix(rest, sep) {
+			return rest[len(sep):], false, true
+		}
+	}
+	return "", false, false
+}
+
+// field coerces the provided query parameter values into the struct field
+// described by f and keyed key, whose parent struct is found at path
+func (d *decoder) field(f *field, key, path string, query []string, v reflect.Value) error {
+	switch f.kindFor(d.opts) {
+	case optionalField:
+		return d.optional(f, key, path, query, v)
+	case sliceField:
+		return d.coerceSlice(f, key, path, query, v)
+	}
+
+	if d.opts.disallowRepeatedKeys && len(query) > 1 {
+		return &UnmarshalTypeError{
+			Key:   key,
+			Field: joinPath(path, f.name),
+			Type:  f.typ,
+			Value: query[1],
+			Err:   ErrRepeatedKey,
+		}
+	}
+	if err := d.coerce(f.coerce, firstValue(query), v); err != nil {
+		return &UnmarshalTypeError{
+			Key:   key,
+			Field: joinPath(path, f.name),
+			Type:  f.typ,
+			Value: firstValue(query),
+			Err:   err,
+		}
+	}
+	return nil
+}
+
+// firstValue returns the first of the query parameter values, treating a key
+// present without any values as having an empty value
+func firstValue(query []string) string {
+	if len(query) == 0 {
+		return ""
+	}
+	return query[0]
+}
+
+// isSlice returns true if the field described by f, or the Value of an
+// Optional field, is coerced from each of its query parameter values
+func (d *decoder) isSlice(f *field) bool {
+	if f.kind == optionalField {
+		f = f.value
+	}
+	return f.kindFor(d.opts) == sliceField
+}
+
+// optional marks the provided Optional field as set, coercing the query
+// parameter values into its Value unless the parameter was empty
+func (d *decoder) optional(f *field, key, path string, query []string, v reflect.Value) error {
+	opt := reflect.New(f.typ).Elem()
+	opt.Field(optionalSet).SetBool(true)
+	if len(query) == 0 || (len(query) == 1 && query[0] == "") {
+		opt.Field(optionalEmpty).SetBool(true)
+	} else if err := d.field(f.value, key, path, query, opt.Field(optionalValue)); err != nil {
+		return err
+	}
+	v.Set(opt)
+	return nil
+}
+
+// coerce converts the provided query parameter value into the target value
+// using the coercion func compiled for its type, unless a converter has been
+// registered for the type
+func (d *decoder) coerce(coerce coerceFunc, query string, v reflect.Value) error {
+	if d.opts.hasConverters() {
+		if conv, ok := d.opts.converter(v.Type()); ok && conv.dec != nil {
+			return decodeConverted(conv.dec, query, v)
+		}
+	}
+	return coerce(d, query, v)
 }
 
 // coerceSlice creates a new slice of the appropriate type for the target field
 // and coerces each of the query parameter values into the destination type.
-// Should any of the provided query parameters fail to be coerced, an error is
-// returned and the entire slice will not be applied
-func (d *decoder) coerceSlice(query []string, target reflect.Kind, field reflect.Value) error {
-	var err error
-	sliceType := field.Type().Elem()
-	coerceKind := sliceType.Kind()
-	sl := reflect.MakeSlice(reflect.SliceOf(sliceType), 0, 0)
-	// Create a pointer to a slice value and set it to the slice
-	slice := reflect.New(sl.Type())
-	slice.Elem().Set(sl)
-	for _, q := range query {
-		val := reflect.New(sliceType).Elem()
-		err = d.coerce(q, coerceKind, val)
-		if err != nil {
+// Should any of the provided query parameters fail to be coerced, an error
+// identifying the offending element is returned and the entire slice will not
+// be applied
+func (d *decoder) coerceSlice(f *field, key, path string, query []string, v reflect.Value) error {
+	if max := d.opts.maxSliceLen; max > 0 && len(query) > max {
+		return &LimitError{Key: key, Limit: "slice length", Max: max}
+	}
+
+	slice := reflect.MakeSlice(v.Type(), len(query), len(query))
+	for i, q := range query {
+		if err := d.coerce(f.elemCoerce, q, slice.Index(i)); err != nil {
+			return &UnmarshalTypeError{
+				Key:   key,
+				Field: joinPath(path, f.name) + "[" + strconv.Itoa(i) + "]",
+				Type:  v.Type().Elem(),
+				Value: q,
+				Err:   err,
+			}
+		}
+	}
+	v.Set(slice)
+	return nil
+}
+
+// coerceFunc converts a single query parameter value into the provided value
+type coerceFunc func(d *decoder, query string, v reflect.Value) error
+
+// newCoerceFunc returns the coercion func for values of type t
+func newCoerceFunc(t reflect.Type) coerceFunc {
+	// time.Time is a TextUnmarshaler, but is parsed by coerceTime so that its
+	// query parameter is unescaped first
+	switch t {
+	case timeType:
+		return coerceTime
+	case comparativeTimeType:
+		return coerceComparativeTime
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return newPtrCoerceFunc(t)
+	}
+
+	pt := reflect.PtrTo(t)
+	switch {
+	case pt.Implements(queryValueUnmarshalerType):
+		return coerceQueryValue
+	case pt.Implements(textUnmarshalerType):
+		return coerceText
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return coerceString
+	case reflect.Bool:
+		return coerceBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return coerceInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return coerceUint
+	case reflect.Float32, reflect.Float64:
+		return coerceFloat
+	}
+	return coerceNothing
+}
+
+// newPtrCoerceFunc returns a coercion func for the pointer type t, which only
+// allocates once the value pointed at has been coerced
+func newPtrCoerceFunc(t reflect.Type) coerceFunc {
+	elemCoerce := newCoerceFunc(t.Elem())
+	return func(d *decoder, query string, v reflect.Value) error {
+		ptr := reflect.New(t.Elem())
+		if err := d.coerce(elemCoerce, query, ptr.Elem()); err != nil {
 			return err
 		}
-		slice.Elem().Set(reflect.Append(slice.Elem(), val))
+		v.Set(ptr)
+		return nil
 	}
-	field.Set(slice.Elem())
+}
+
+func coerceNothing(d *decoder, query string, v reflect.Value) error {
+	return nil
+}
+
+func coerceQueryValue(d *decoder, query string, v reflect.Value) error {
+	return v.Addr().Interface().(QueryValueUnmarshaler).UnmarshalQueryValue(query)
+}
+
+func coerceText(d *decoder, query string, v reflect.Value) error {
+	return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(query))
+}
+
+func coerceString(d *decoder, query string, v reflect.Value) error {
+	v.SetString(query)
 	return nil
 }
+
+func coerceBool(d *decoder, query string, v reflect.Value) error {
+	b, err := strconv.ParseBool(query)
+	if err == nil {
+		v.SetBool(b)
+	}
+	return err
+}
+
+func coerceInt(d *decoder, query string, v reflect.Value) error {
+	i, err := strconv.ParseInt(query, 10, v.Type().Bits())
+	if err == nil {
+		v.SetInt(i)
+	}
+	return err
+}
+
+func coerceUint(d *decoder, query string, v reflect.Value) error {
+	u, err := strconv.ParseUint(query, 10, v.Type().Bits())
+	if err == nil {
+		v.SetUint(u)
+	}
+	return err
+}
+
+func coerceFloat(d *decoder, query string, v reflect.Value) error {
+	f, err := strconv.ParseFloat(query, v.Type().Bits())
+	if err == nil {
+		v.SetFloat(f)
+	}
+	return err
+}
+
+func coerceTime(d *decoder, query string, v reflect.Value) error {
+	// unescape the query parameter before attempting to parse it
+	query, err := url.QueryUnescape(query)
+	if err != nil {
+		return err
+	}
+
+	t, err := d.opts.parseTime(query)
+	if err == nil {
+		v.Set(reflect.ValueOf(t))
+	}
+	return err
+}
+
+func coerceComparativeTime(d *decoder, query string, v reflect.Value) error {
+	// unescape the query parameter before attempting to parse it
+	query, err := url.QueryUnescape(query)
+	if err != nil {
+		return err
+	}
+
+	t := *NewComparativeTime()
+	err = t.parse(query, d.opts.parseTime)
+	if err == nil {
+		v.Set(reflect.ValueOf(t))
+	}
+	return err
+}
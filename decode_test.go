@@ -2,7 +2,11 @@ package qstring
 
 import (
 	"errors"
+	"math/big"
+	"net"
 	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -181,6 +185,29 @@ func TestUnmarshalInvalidTypes(t *testing.T) {
 	}
 }
 
+func TestUnmarshalEmptyValues(t *testing.T) {
+	type Query struct {
+		Sort string `qstring:"sort,oneof=|asc|desc"`
+		IDs  []int
+		Meta map[string]string
+	}
+
+	params := &Query{Sort: "asc"}
+	query := url.Values{"sort": {}, "ids": {}, "meta[color]": {}}
+	if err := Unmarshal(query, params); err != nil {
+		t.Fatalf("Expected keys without values to unmarshal, got %v", err)
+	}
+	if params.Sort != "" || len(params.IDs) != 0 || params.Meta["color"] != "" {
+		t.Errorf("Expected empty values, got %+v", params)
+	}
+
+	var typeErr *UnmarshalTypeError
+	err := Unmarshal(url.Values{"limit": {}}, &struct{ Limit int }{})
+	if !errors.As(err, &typeErr) || typeErr.Value != "" {
+		t.Errorf("Expected an UnmarshalTypeError for an empty limit, got %v", err)
+	}
+}
+
 var errNoNames = errors.New("No Names Provided")
 
 type MarshalInterfaceTest struct {
@@ -212,3 +239,729 @@ func TestUnmarshaller(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalTypeError(t *testing.T) {
+	type Paging struct {
+		Limit int
+	}
+
+	type Query struct {
+		PageInfo Paging
+		IDs      []int
+		Created  time.Time
+		Small    int8
+		Byte     uint8
+		Ratio    float32
+	}
+
+	testio := []struct {
+		inp   url.Values
+		key   string
+		field string
+		value string
+	}{
+		{inp: url.Values{"limit": []string{"abc"}}, key: "limit",
+			field: "PageInfo.Limit", value: "abc"},
+		{inp: url.Values{"ids": []string{"1", "x"}}, key: "ids",
+			field: "IDs[1]", value: "x"},
+		{inp: url.Values{"created": []string{"yesterday"}}, key: "created",
+			field: "Created", value: "yesterday"},
+		{inp: url.Values{"small": []string{"300"}}, key: "small",
+			field: "Small", value: "300"},
+		{inp: url.Values{"byte": []string{"256"}}, key: "byte",
+			field: "Byte", value: "256"},
+		{inp: url.Values{"ratio": []string{"1e300"}}, key: "ratio",
+			field: "Ratio", value: "1e300"},
+	}
+
+	for _, test := range testio {
+		err := Unmarshal(test.inp, &Query{})
+		var typeErr *UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			t.Errorf("Expected *UnmarshalTypeError, got %v", err)
+			continue
+		}
+
+		if typeErr.Key != test.key || typeErr.Field != test.field ||
+			typeErr.Value != test.value {
+			t.Errorf("Expected key %q, field %q and value %q, got %q, %q and %q",
+				test.key, test.field, test.value,
+				typeErr.Key, typeErr.Field, typeErr.Value)
+		}
+
+		if typeErr.Err == nil {
+			t.Errorf("Expected %q to wrap the underlying parse error", err)
+		}
+	}
+}
+
+func TestUnmarshalAll(t *testing.T) {
+	type Query struct {
+		Name  string
+		Limit int
+		Page  int
+		IDs   []int
+	}
+
+	query := url.Values{
+		"name":  []string{"SomeName"},
+		"limit": []string{"ten"},
+		"page":  []string{"one"},
+		"ids":   []string{"1", "2"},
+	}
+
+	params := &Query{}
+	err := UnmarshalAll(query, params)
+
+	var errs DecodeErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected DecodeErrors, got %v", err)
+	}
+
+	if len(errs) != 2 {
+		t.Errorf("Expected 2 errors, got %d: %v", len(errs), errs)
+	}
+
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Key != "limit" {
+		t.Errorf("Expected first error to be for limit, got %v", typeErr)
+	}
+
+	if params.Name != "SomeName" || len(params.IDs) != 2 {
+		t.Errorf("Expected valid fields to be decoded, got %+v", params)
+	}
+
+	err = NewDecoder(CollectErrors()).Unmarshal(url.Values{"name": []string{"x"}}, params)
+	if err != nil {
+		t.Errorf("Expected nil error for a valid query, got %v", err)
+	}
+}
+
+func TestDisallowUnknownKeys(t *testing.T) {
+	type Paging struct {
+		Page  int
+		Limit int
+	}
+
+	type Query struct {
+		Paging Paging
+		Name   string
+		Hidden string `qstring:"-"`
+	}
+
+	query := url.Values{
+		"name":   []string{"SomeName"},
+		"page":   []string{"1"},
+		"limt":   []string{"50"},
+		"hidden": []string{"secret"},
+	}
+
+	err := NewDecoder(DisallowUnknownKeys()).Unmarshal(query, &Query{})
+	var unknown *UnknownKeysError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("Expected *UnknownKeysError, got %v", err)
+	}
+
+	expected := []string{"hidden", "limt"}
+	if len(unknown.Keys) != len(expected) {
+		t.Fatalf("Expected unknown keys %q, got %q", expected, unknown.Keys)
+	}
+	for i, key := range expected {
+		if unknown.Keys[i] != key {
+			t.Errorf("Expected unknown keys %q, got %q", expected, unknown.Keys)
+		}
+	}
+
+	delete(query, "limt")
+	delete(query, "hidden")
+	if err = NewDecoder(DisallowUnknownKeys()).Unmarshal(query, &Query{}); err != nil {
+		t.Errorf("Expected no error for known keys, got %v", err)
+	}
+
+	if err = Unmarshal(url.Values{"limt": []string{"50"}}, &Query{}); err != nil {
+		t.Errorf("Expected unknown keys to be ignored by default, got %v", err)
+	}
+}
+
+func TestUnmarshalRemain(t *testing.T) {
+	type Query struct {
+		Name   string
+		Limit  int
+		Extras url.Values `qstring:",remain"`
+	}
+
+	query := url.Values{
+		"name":   []string{"SomeName"},
+		"limit":  []string{"50"},
+		"status": []string{"open", "closed"},
+		"owner":  []string{"me"},
+	}
+
+	params := &Query{}
+	err := NewDecoder(DisallowUnknownKeys()).Unmarshal(query, params)
+	if err != nil {
+		t.Fatalf("Expected remain field to consume unknown keys, got %v", err)
+	}
+
+	if len(params.Extras) != 2 {
+		t.Fatalf("Expected 2 leftover keys, got %q", params.Extras)
+	}
+
+	if len(params.Extras["status"]) != 2 || params.Extras.Get("owner") != "me" {
+		t.Errorf("Unexpected leftover parameters %q", params.Extras)
+	}
+
+	if _, ok := params.Extras["name"]; ok {
+		t.Errorf("Expected consumed key name to be excluded from %q", params.Extras)
+	}
+}
+
+func TestUnmarshalRemainNestedPtr(t *testing.T) {
+	type Inner struct {
+		Rest url.Values `qstring:",remain"`
+	}
+	type Query struct {
+		Limit int
+		In    *Inner
+	}
+
+	params := &Query{}
+	err := Unmarshal(url.Values{"limit": {"5"}, "other": {"x"}}, params)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if params.In == nil || params.In.Rest.Get("other") != "x" {
+		t.Fatalf("Expected leftover key other to reach nested remain field, got %+v", params.In)
+	}
+
+	params = &Query{}
+	err = Unmarshal(url.Values{"limit": {"5"}}, params)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if params.In != nil {
+		t.Errorf("Expected nested pointer to stay nil without leftovers, got %+v", params.In)
+	}
+}
+
+func TestUnmarshalRemainSliceElement(t *testing.T) {
+	type Item struct {
+		SKU  string
+		Rest url.Values `qstring:",remain"`
+	}
+	type Query struct {
+		Items []Item
+	}
+
+	query := url.Values{"items[0][sku]": {"a"}, "other": {"x"}}
+	params := &Query{}
+	if err := Unmarshal(query, params); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(params.Items) != 1 || params.Items[0].SKU != "a" {
+		t.Fatalf("Unexpected items %+v", params.Items)
+	}
+	if params.Items[0].Rest != nil {
+		t.Errorf("Expected remain field within slice element to be ignored, got %q", params.Items[0].Rest)
+	}
+
+	err := NewDecoder(DisallowUnknownKeys()).Unmarshal(query, &Query{})
+	if _, ok := err.(*UnknownKeysError); !ok {
+		t.Errorf("Expected *UnknownKeysError for key other, got %v", err)
+	}
+}
+
+func TestUnmarshalRequired(t *testing.T) {
+	type Paging struct {
+		Page  int `qstring:"page,required"`
+		Limit int
+	}
+
+	type Query struct {
+		Paging Paging
+		Name   *string  `qstring:"name,required"`
+		IDs    []int    `qstring:"ids,required"`
+		Tags   []string `qstring:"tags"`
+	}
+
+	testio := []struct {
+		inp     url.Values
+		missing []string
+	}{
+		{inp: url.Values{}, missing: []string{"page", "name", "ids"}},
+		{inp: url.Values{"page": []string{"1"}, "ids": []string{"1", "2"}},
+			missing: []string{"name"}},
+		{inp: url.Values{"page": []string{"1"}, "ids": []string{"1"},
+			"name": []string{"x"}}, missing: nil},
+	}
+
+	for _, test := range testio {
+		err := Unmarshal(test.inp, &Query{})
+		if test.missing == nil {
+			if err != nil {
+				t.Errorf("Expected no error for %q, got %v", test.inp, err)
+			}
+			continue
+		}
+
+		var missing *MissingParameterError
+		if !errors.As(err, &missing) {
+			t.Errorf("Expected *MissingParameterError, got %v", err)
+			continue
+		}
+
+		if strings.Join(missing.Keys, ",") != strings.Join(test.missing, ",") {
+			t.Errorf("Expected missing keys %q, got %q", test.missing, missing.Keys)
+		}
+	}
+}
+
+func TestUnmarshalDefaults(t *testing.T) {
+	type Paging struct {
+		Page  int `qstring:"page,default=1"`
+		Limit int `qstring:"limit,default=25"`
+	}
+
+	type Query struct {
+		Paging  Paging
+		Sort    []string        `qstring:"sort,default=name|-created"`
+		Since   time.Time       `qstring:"since,default=2006-01-02T15:04:05Z"`
+		Created ComparativeTime `qstring:"created,default=>=2016-01-02T15:04:05Z"`
+	}
+
+	params := &Query{}
+	err := Unmarshal(url.Values{"limit": []string{"50"}}, params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if params.Paging.Page != 1 || params.Paging.Limit != 50 {
+		t.Errorf("Expected page 1 and limit 50, got %+v", params.Paging)
+	}
+
+	if len(params.Sort) != 2 || params.Sort[1] != "-created" {
+		t.Errorf("Expected default sort of [name -created], got %q", params.Sort)
+	}
+
+	if params.Since.Format(time.RFC3339) != "2006-01-02T15:04:05Z" {
+		t.Errorf("Expected default since, got %s", params.Since)
+	}
+
+	if params.Created.String() != ">=2016-01-02T15:04:05Z" {
+		t.Errorf("Expected default created, got %s", params.Created)
+	}
+
+	type Invalid struct {
+		Limit int `qstring:"limit,default=many"`
+	}
+
+	var typeErr *UnmarshalTypeError
+	err = Unmarshal(url.Values{}, &Invalid{})
+	if !errors.As(err, &typeErr) || typeErr.Value != "many" {
+		t.Errorf("Expected invalid default to be reported, got %v", err)
+	}
+}
+
+type OrderStatus int
+
+const (
+	StatusOpen OrderStatus = iota + 1
+	StatusClosed
+)
+
+var errUnknownStatus = errors.New("unknown order status")
+
+func (s *OrderStatus) UnmarshalQueryValue(v string) error {
+	switch v {
+	case "open":
+		*s = StatusOpen
+	case "closed":
+		*s = StatusClosed
+	default:
+		return errUnknownStatus
+	}
+	return nil
+}
+
+func (s OrderStatus) MarshalQueryValue() (string, error) {
+	switch s {
+	case StatusOpen:
+		return "open", nil
+	case StatusClosed:
+		return "closed", nil
+	}
+	return "", errUnknownStatus
+}
+
+type StatusQuery struct {
+	Status   OrderStatus
+	Statuses []OrderStatus
+}
+
+func TestUnmarshalQueryValue(t *testing.T) {
+	query := url.Values{
+		"status":   []string{"closed"},
+		"statuses": []string{"open", "closed"},
+	}
+
+	params := &StatusQuery{}
+	if err := Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if params.Status != StatusClosed {
+		t.Errorf("Expected status %d, got %d", StatusClosed, params.Status)
+	}
+
+	if len(params.Statuses) != 2 || params.Statuses[0] != StatusOpen {
+		t.Errorf("Expected statuses [open closed], got %v", params.Statuses)
+	}
+
+	query.Set("status", "pending")
+	err := Unmarshal(query, params)
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) || !errors.Is(err, errUnknownStatus) {
+		t.Errorf("Expected wrapped %v, got %v", errUnknownStatus, err)
+	}
+}
+
+func TestUnmarshalText(t *testing.T) {
+	type Query struct {
+		Addr  net.IP
+		Addrs []net.IP
+		Count big.Int
+	}
+
+	query := url.Values{
+		"addr":  []string{"10.0.0.1"},
+		"addrs": []string{"10.0.0.2", "::1"},
+		"count": []string{"123456789012345678901234567890"},
+	}
+
+	params := &Query{}
+	if err := Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !params.Addr.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Expected addr 10.0.0.1, got %s", params.Addr)
+	}
+
+	if len(params.Addrs) != 2 || !params.Addrs[1].Equal(net.IPv6loopback) {
+		t.Errorf("Expected addrs [10.0.0.2 ::1], got %v", params.Addrs)
+	}
+
+	if params.Count.String() != "123456789012345678901234567890" {
+		t.Errorf("Expected count to be decoded, got %s", params.Count.String())
+	}
+
+	var typeErr *UnmarshalTypeError
+	err := Unmarshal(url.Values{"addr": []string{"nope"}}, params)
+	if !errors.As(err, &typeErr) || typeErr.Field != "Addr" {
+		t.Errorf("Expected *UnmarshalTypeError for Addr, got %v", err)
+	}
+}
+
+func TestUnmarshalPointers(t *testing.T) {
+	type Paging struct {
+		Page  int `qstring:"page"`
+		Limit int `qstring:"limit,default=25"`
+	}
+
+	type Query struct {
+		Name    *string
+		Limit   *int `qstring:"limit,max=100"`
+		Do      *bool
+		Created *time.Time
+		Since   *ComparativeTime
+		Count   *big.Int
+		IDs     []*int
+		Paging  *Paging
+	}
+
+	query := url.Values{
+		"name":    []string{""},
+		"limit":   []string{"0"},
+		"created": []string{"2006-01-02T15:04:05Z"},
+		"since":   []string{">2006-01-02T15:04:05Z"},
+		"count":   []string{"42"},
+		"ids":     []string{"1", "2"},
+	}
+
+	params := &Query{}
+	if err := Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if params.Name == nil || *params.Name != "" {
+		t.Errorf("Expected name to be set to an empty string, got %v", params.Name)
+	}
+
+	if params.Limit == nil || *params.Limit != 0 {
+		t.Errorf("Expected limit to be set to 0, got %v", params.Limit)
+	}
+
+	if params.Do != nil {
+		t.Errorf("Expected absent do to be left nil, got %v", *params.Do)
+	}
+
+	if params.Created == nil || params.Created.Format(time.RFC3339) != "2006-01-02T15:04:05Z" {
+		t.Errorf("Expected created to be set, got %v", params.Created)
+	}
+
+	if params.Since == nil || params.Since.Operator != ">" {
+		t.Errorf("Expected since to be set, got %v", params.Since)
+	}
+
+	if params.Count == nil || params.Count.Int64() != 42 {
+		t.Errorf("Expected count to be set, got %v", params.Count)
+	}
+
+	if len(params.IDs) != 2 || *params.IDs[1] != 2 {
+		t.Errorf("Expected ids [1 2], got %v", params.IDs)
+	}
+
+	// limit is shared with the nested struct, which is therefore allocated
+	if params.Paging == nil || params.Paging.Limit != 0 {
+		t.Errorf("Expected paging to be allocated, got %+v", params.Paging)
+	}
+
+	params = &Query{}
+	if err := Unmarshal(url.Values{"do": []string{"true"}}, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if params.Paging != nil {
+		t.Errorf("Expected paging to be left nil, got %+v", params.Paging)
+	}
+
+	var typeErr *UnmarshalTypeError
+	err := Unmarshal(url.Values{"limit": []string{"x"}}, &Query{})
+	if !errors.As(err, &typeErr) || typeErr.Field != "Limit" {
+		t.Errorf("Expected *UnmarshalTypeError for Limit, got %v", err)
+	}
+}
+
+func TestUnmarshalAliases(t *testing.T) {
+	type Query struct {
+		Limit int `qstring:"limit,alias=per_page|count"`
+		Name  string
+	}
+
+	var testio = []struct {
+		query    url.Values
+		expected int
+	}{
+		{url.Values{"limit": []string{"1"}}, 1},
+		{url.Values{"per_page": []string{"2"}}, 2},
+		{url.Values{"count": []string{"3"}}, 3},
+		{url.Values{"count": []string{"3"}, "per_page": []string{"2"}}, 2},
+		{url.Values{"count": []string{"3"}, "limit": []string{"1"}}, 1},
+	}
+
+	dec := NewDecoder(DisallowUnknownKeys())
+	for _, test := range testio {
+		params := &Query{}
+		if err := dec.Unmarshal(test.query, params); err != nil {
+			t.Fatal(err.Error())
+		}
+		if params.Limit != test.expected {
+			t.Errorf("Expected limit of %d for %v, got %d", test.expected, test.query, params.Limit)
+		}
+	}
+}
+
+func TestCaseInsensitiveKeys(t *testing.T) {
+	type Query struct {
+		Limit int        `qstring:"limit,alias=per_page"`
+		Name  string     `qstring:"name"`
+		Extra url.Values `qstring:",remain"`
+	}
+
+	var testio = []struct {
+		query    url.Values
+		limit    int
+		name     string
+		extraKey string
+	}{
+		{url.Values{"LIMIT": []string{"1"}, "Name": []string{"a"}}, 1, "a", ""},
+		{url.Values{"Limit": []string{"1"}, "limit": []string{"2"}}, 2, "", ""},
+		{url.Values{"Limit": []string{"1"}, "LIMIT": []string{"2"}}, 2, "", ""},
+		{url.Values{"Per_Page": []string{"3"}, "other": []string{"x"}}, 3, "", "other"},
+		{url.Values{"Limit": []string{"1"}, "per_page": []string{"3"}}, 3, "", ""},
+	}
+
+	dec := NewDecoder(CaseInsensitiveKeys())
+	for _, test := range testio {
+		params := &Query{}
+		if err := dec.Unmarshal(test.query, params); err != nil {
+			t.Fatal(err.Error())
+		}
+		if params.Limit != test.limit || params.Name != test.name {
+			t.Errorf("Unexpected params %+v for %v", params, test.query)
+		}
+		if len(params.Extra) > 1 || (test.extraKey != "" && params.Extra[test.extraKey] == nil) {
+			t.Errorf("Expected only %q to remain, got %v", test.extraKey, params.Extra)
+		}
+	}
+
+	params := &Query{}
+	if err := Unmarshal(url.Values{"LIMIT": []string{"1"}}, params); err != nil || params.Limit != 0 {
+		t.Errorf("Expected keys to be case sensitive by default, got %+v (%v)", params, err)
+	}
+}
+
+func TestUnmarshalDeprecated(t *testing.T) {
+	type Paging struct {
+		Page int `qstring:"page,deprecated"`
+	}
+	type Item struct {
+		SKU string
+	}
+	type Query struct {
+		Limit  int `qstring:"limit,alias=per_page,deprecated=use size"`
+		Size   int
+		Paging Paging
+		Items  []Item            `qstring:"items,deprecated"`
+		Meta   map[string]string `qstring:"meta,deprecated=use tags"`
+	}
+
+	var reported []Deprecation
+	dec := NewDecoder(OnDeprecated(func(d Deprecation) {
+		reported = append(reported, d)
+	}))
+
+	query := url.Values{
+		"per_page":      []string{"10"},
+		"page":          []string{"2"},
+		"size":          []string{"5"},
+		"items[0][sku]": []string{"a"},
+		"items[1][sku]": []string{"b"},
+		"meta[color]":   []string{"red"},
+	}
+	params := &Query{}
+	deprecations, err := dec.UnmarshalWithWarnings(query, params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []Deprecation{
+		{Key: "per_page", Field: "Limit", Message: "use size"},
+		{Key: "page", Field: "Paging.Page"},
+		{Key: "items", Field: "Items"},
+		{Key: "meta", Field: "Meta", Message: "use tags"},
+	}
+	if !reflect.DeepEqual(deprecations, expected) {
+		t.Errorf("Expected deprecations %+v, got %+v", expected, deprecations)
+	}
+	if !reflect.DeepEqual(reported, expected) {
+		t.Errorf("Expected reported deprecations %+v, got %+v", expected, reported)
+	}
+	if params.Limit != 10 || params.Paging.Page != 2 {
+		t.Errorf("Expected deprecated parameters to be unmarshaled, got %+v", params)
+	}
+
+	msgs := []string{
+		`parameter "per_page" is deprecated: use size`,
+		`parameter "page" is deprecated`,
+	}
+	for i, msg := range msgs {
+		if got := deprecations[i].String(); got != msg {
+			t.Errorf("Expected %q, got %q", msg, got)
+		}
+	}
+
+	deprecations, err = dec.UnmarshalWithWarnings(url.Values{"size": []string{"5"}}, &Query{})
+	if err != nil || deprecations != nil {
+		t.Errorf("Expected no deprecations, got %+v (%v)", deprecations, err)
+	}
+}
+
+func TestUnmarshalMaps(t *testing.T) {
+	type Query struct {
+		Meta   map[string]string
+		Counts map[string]int
+		Tags   map[string][]string `qstring:"tags"`
+		Limit  int
+	}
+
+	query := url.Values{
+		"meta[color]": []string{"red"},
+		"meta.size":   []string{"large"},
+		"meta[size]":  []string{"small"},
+		"counts.a":    []string{"1"},
+		"tags[b]":     []string{"x", "y"},
+		"limit":       []string{"10"},
+	}
+
+	params := &Query{}
+	if err := NewDecoder(DisallowUnknownKeys()).Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := &Query{
+		Meta:   map[string]string{"color": "red", "size": "small"},
+		Counts: map[string]int{"a": 1},
+		Tags:   map[string][]string{"b": {"x", "y"}},
+		Limit:  10,
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, params)
+	}
+
+	err := Unmarshal(url.Values{"counts[b]": []string{"x"}}, &Query{})
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Key != "counts[b]" || typeErr.Field != `Counts["b"]` {
+		t.Errorf("Expected an UnmarshalTypeError for counts[b], got %v", err)
+	}
+
+	params = &Query{}
+	if err = Unmarshal(url.Values{"meta[]": []string{"x"}, "meta[a][b]": []string{"y"}}, params); err != nil {
+		t.Fatal(err.Error())
+	}
+	if params.Meta != nil {
+		t.Errorf("Expected malformed keys to be ignored, got %v", params.Meta)
+	}
+}
+
+type Node struct {
+	Name   string
+	Parent *Node
+}
+
+func TestUnmarshalSelfReferential(t *testing.T) {
+	params := &Node{}
+	if err := Unmarshal(url.Values{"name": []string{"a"}}, params); err != nil {
+		t.Fatal(err.Error())
+	}
+	if params.Name != "a" || params.Parent != nil {
+		t.Errorf("Unexpected flat node %+v", params)
+	}
+
+	query := url.Values{
+		"name":                 []string{"a"},
+		"parent[name]":         []string{"b"},
+		"parent[parent][name]": []string{"c"},
+	}
+	params = &Node{}
+	if err := NewDecoder(Nesting(BracketNesting)).Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := &Node{Name: "a", Parent: &Node{Name: "b", Parent: &Node{Name: "c"}}}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, params)
+	}
+
+	type Tree struct {
+		Name  string
+		Items []Node
+	}
+	tree := &Tree{}
+	err := Unmarshal(url.Values{"items[0][name]": []string{"x"}}, tree)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(tree.Items) != 1 || tree.Items[0].Name != "x" || tree.Items[0].Parent != nil {
+		t.Errorf("Unexpected tree %+v", tree)
+	}
+}
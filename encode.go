@@ -1,10 +1,12 @@
 package qstring
 
 import (
+	"encoding"
+	"fmt"
 	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -14,17 +16,51 @@ type Marshaller interface {
 	MarshalQuery() (url.Values, error)
 }
 
+// QueryValueMarshaler defines the interface for types which marshal themselves
+// into a single query parameter value. It is honoured for struct fields and the
+// elements of slice fields, and takes precedence over encoding.TextMarshaler
+type QueryValueMarshaler interface {
+	MarshalQueryValue() (string, error)
+}
+
 // Marshal marshals the provided struct into a url.Values collection
 func Marshal(v interface{}) (url.Values, error) {
-	var e encoder
-	e.init(v)
-	return e.marshal()
+	return defaultEncoder.Marshal(v)
 }
 
 // Marshal marshals the provided struct into a raw query string and returns a
 // conditional error
 func MarshalString(v interface{}) (string, error) {
-	vals, err := Marshal(v)
+	return defaultEncoder.MarshalString(v)
+}
+
+var defaultEncoder = NewEncoder()
+
+// An Encoder marshals structs into query strings according to the options it
+// was created with. An Encoder is safe for concurrent use by multiple
+// goroutines, allowing it to be configured once and shared
+type Encoder struct {
+	opts options
+}
+
+// NewEncoder returns a new Encoder configured with the provided options
+func NewEncoder(opts ...Option) *Encoder {
+	enc := &Encoder{}
+	enc.opts.apply(opts)
+	return enc
+}
+
+// Marshal marshals the provided struct into a url.Values collection
+func (enc *Encoder) Marshal(v interface{}) (url.Values, error) {
+	var e encoder
+	e.init(v, &enc.opts)
+	return e.marshal()
+}
+
+// MarshalString marshals the provided struct into a raw query string and
+// returns a conditional error
+func (enc *Encoder) MarshalString(v interface{}) (string, error) {
+	vals, err := enc.Marshal(v)
 	if err != nil {
 		return "", err
 	}
@@ -50,10 +86,16 @@ func (e InvalidMarshalError) Error() string {
 
 type encoder struct {
 	data interface{}
+	opts *options
+
+	// elements counts the struct slice elements being marshaled along the
+	// current path, within which remain fields are ignored
+	elements int
 }
 
-func (e *encoder) init(v interface{}) *encoder {
+func (e *encoder) init(v interface{}, opts *options) *encoder {
 	e.data = v
+	e.opts = opts
 	return e
 }
 
@@ -72,90 +114,299 @@ func (e *encoder) marshal() (url.Values, error) {
 }
 
 func (e *encoder) value(val reflect.Value) (url.Values, error) {
-	elem := val.Elem()
-	typ := elem.Type()
-
-	var err error
-	var output = make(url.Values)
-	for i := 0; i < elem.NumField(); i++ {
-		// pull out the qstring struct tag
-		elemField := elem.Field(i)
-		typField := typ.Field(i)
-		qstring, omit := parseTag(typField.Tag.Get(Tag))
-		if qstring == "" {
-			// resolvable fields must have at least the `flag` struct tag
-			qstring = strings.ToLower(typField.Name)
-		}
+	output := make(url.Values)
+	if err := e.fields(output, val.Elem(), ""); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// fields marshals each of the fields of the provided struct into the output,
+// nesting their keys within the key prefix
+func (e *encoder) fields(output url.Values, elem reflect.Value, prefix string) error {
+	var remain reflect.Value
+	fields := e.opts.cachedTypeFields(elem.Type())
+	for i := range fields.list {
+		f := &fields.list[i]
+		elemField := elem.Field(f.index)
 
-		// determine if this is an unsettable field or was explicitly set to be
-		// ignored
-		if !elemField.CanSet() || qstring == "-" || (omit && isEmptyValue(elemField)) {
+		// determine if this field was set to be omitted when empty
+		if f.opts.omitEmpty && isEmptyValue(elemField) {
 			continue
 		}
 
-		// only do work if the current fields query string parameter was provided
-		switch k := typField.Type.Kind(); k {
+		var err error
+		key := e.opts.nestKey(prefix, f.key)
+		switch f.kindFor(e.opts) {
+		case remainField:
+			// leftover parameters are merged in once every other field is
+			// marshaled, those within slice elements are ignored
+			if !remain.IsValid() && e.elements == 0 {
+				remain = elemField
+			}
+		case nestedField:
+			err = e.nested(output, elemField, e.opts.nestedPrefix(prefix, f))
+		case nestedPtrField:
+			// nil pointers are omitted, otherwise the struct pointed at is
+			// marshaled
+			if !elemField.IsNil() {
+				err = e.nested(output, elemField.Elem(), e.opts.nestedPrefix(prefix, f))
+			}
+		case structSliceField:
+			err = e.structSlice(output, key, elemField)
+		case mapField:
+			err = e.mapField(output, f, key, elemField)
 		default:
-			output.Set(qstring, marshalValue(elemField, k))
-		case reflect.Slice:
-			output[qstring] = marshalSlice(elemField)
-		case reflect.Ptr:
-			marshalStruct(output, qstring, reflect.Indirect(elemField), k)
-		case reflect.Struct:
-			marshalStruct(output, qstring, elemField, k)
+			err = e.field(output, f, key, elemField)
 		}
+		if err != nil {
+			return fmt.Errorf("qstring: unable to marshal %s: %w", key, err)
+		}
+	}
+
+	if remain.IsValid() {
+		marshalRemain(output, remain)
 	}
-	return output, err
+	return nil
 }
 
-func marshalSlice(field reflect.Value) []string {
+// field marshals the provided value of the field described by f into the
+// output under key
+func (e *encoder) field(output url.Values, f *field, key string, v reflect.Value) error {
+	switch f.kindFor(e.opts) {
+	case optionalField:
+		// unset Optionals are omitted and empty ones written without a value
+		if !v.Field(optionalSet).Bool() {
+			return nil
+		}
+		if v.Field(optionalEmpty).Bool() {
+			output.Set(key, "")
+			return nil
+		}
+		return e.field(output, f.value, key, v.Field(optionalValue))
+	case sliceField:
+		vals, err := e.marshalSlice(f, v)
+		if err != nil {
+			return err
+		}
+		if sep := e.opts.delimiter(f); sep != "" && len(vals) > 0 {
+			vals = []string{joinValues(vals, sep)}
+		}
+		output[key] = vals
+		return nil
+	}
+
+	// nil pointers are omitted, otherwise the value pointed at is marshaled
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	s, err := e.format(f.format, v)
+	if err == nil {
+		output.Set(key, s)
+	}
+	return err
+}
+
+// marshalRemain merges the parameters held by a remain field into the output,
+// without replacing any keys already marshaled from other fields
+func marshalRemain(output url.Values, field reflect.Value) {
+	iter := field.MapRange()
+	for iter.Next() {
+		key := iter.Key().String()
+		if _, ok := output[key]; !ok {
+			output[key] = iter.Value().Convert(stringsType).Interface().([]string)
+		}
+	}
+}
+
+func (e *encoder) marshalSlice(f *field, v reflect.Value) ([]string, error) {
 	var out []string
-	for i := 0; i < field.Len(); i++ {
-		out = append(out, marshalValue(field.Index(i), field.Index(i).Kind()))
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		if elem.Kind() == reflect.Ptr && elem.IsNil() {
+			continue
+		}
+
+		s, err := e.format(f.elemFormat, elem)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
 	}
-	return out
+	return out, nil
 }
 
-func marshalValue(field reflect.Value, source reflect.Kind) string {
-	switch source {
-	case reflect.String:
-		return field.String()
-	case reflect.Bool:
-		return strconv.FormatBool(field.Bool())
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return strconv.FormatInt(field.Int(), 10)
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return strconv.FormatUint(field.Uint(), 10)
-	case reflect.Float32, reflect.Float64:
-		return strconv.FormatFloat(field.Float(), 'G', -1, 64)
-	case reflect.Struct:
-		switch field.Interface().(type) {
-		case time.Time:
-			return field.Interface().(time.Time).Format(time.RFC3339)
-		case ComparativeTime:
-			return field.Interface().(ComparativeTime).String()
+// format converts the provided value into a query parameter value using the
+// format func compiled for its type, unless a converter has been registered
+// for the type
+func (e *encoder) format(format formatFunc, v reflect.Value) (string, error) {
+	if e.opts.hasConverters() {
+		if conv, ok := e.opts.converter(v.Type()); ok && conv.enc != nil {
+			return conv.enc(v.Interface())
 		}
 	}
-	return ""
+	return format(e, v)
 }
 
-func marshalStruct(output url.Values, qstring string, field reflect.Value, source reflect.Kind) error {
-	var err error
-	switch field.Interface().(type) {
-	case time.Time, ComparativeTime:
-		output.Set(qstring, marshalValue(field, source))
-	default:
-		var vals url.Values
-		if field.CanAddr() {
-			vals, err = Marshal(field.Addr().Interface())
+// nested merges the query parameters of a nested struct into the output,
+// nesting their keys within the key prefix
+func (e *encoder) nested(output url.Values, v reflect.Value, prefix string) error {
+	if !e.opts.cachedTypeFields(v.Type()).marshaller {
+		return e.fields(output, v, prefix)
+	}
+
+	vals, err := v.Addr().Interface().(Marshaller).MarshalQuery()
+	if err != nil {
+		return err
+	}
+	for key, list := range vals {
+		output[e.opts.nestKey(prefix, key)] = list
+	}
+	return nil
+}
+
+// structSlice marshals each of the elements of a slice of structs under indexed
+// keys such as items[0][sku]. Nil elements are omitted
+func (e *encoder) structSlice(output url.Values, key string, v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				continue
+			}
+			elem = elem.Elem()
 		}
 
+		e.elements++
+		err := e.nested(output, elem, indexKey(key, i))
+		e.elements--
 		if err != nil {
 			return err
 		}
-		for key, list := range vals {
-			output[key] = list
+	}
+	return nil
+}
+
+// mapField marshals each of the entries of a map keyed by strings under keys
+// such as meta[color], in sorted order
+func (e *encoder) mapField(output url.Values, f *field, key string, v reflect.Value) error {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	// entries are copied into an addressable value so that methods with
+	// pointer receivers can be called
+	elem := reflect.New(v.Type().Elem()).Elem()
+	for _, k := range keys {
+		elem.Set(v.MapIndex(k))
+		if err := e.field(output, f.value, e.opts.mapKey(key, k.String()), elem); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+// formatFunc converts the provided value into a single query parameter value
+type formatFunc func(e *encoder, v reflect.Value) (string, error)
+
+// newFormatFunc returns the format func for values of type t
+func newFormatFunc(t reflect.Type) formatFunc {
+	// time.Time is a TextMarshaler, but is formatted by formatTime without the
+	// fractional seconds it would otherwise include
+	switch t {
+	case timeType:
+		return formatTime
+	case comparativeTimeType:
+		return formatComparativeTime
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return newPtrFormatFunc(t)
+	}
+
+	pt := reflect.PtrTo(t)
+	switch {
+	case pt.Implements(queryValueMarshalerType):
+		return formatQueryValue
+	case pt.Implements(textMarshalerType):
+		return formatText
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return formatString
+	case reflect.Bool:
+		return formatBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return formatInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return formatUint
+	case reflect.Float32, reflect.Float64:
+		return formatFloat
+	}
+	return formatNothing
+}
+
+// newPtrFormatFunc returns a format func for the pointer type t which formats
+// the value pointed at
+func newPtrFormatFunc(t reflect.Type) formatFunc {
+	elemFormat := newFormatFunc(t.Elem())
+	return func(e *encoder, v reflect.Value) (string, error) {
+		if v.IsNil() {
+			return "", nil
+		}
+		return e.format(elemFormat, v.Elem())
+	}
+}
+
+func formatNothing(e *encoder, v reflect.Value) (string, error) {
+	return "", nil
+}
+
+// addressed returns a pointer to v if it is addressable, so that methods with
+// pointer receivers can be called
+func addressed(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v.Addr()
+	}
+	return v
+}
+
+func formatQueryValue(e *encoder, v reflect.Value) (string, error) {
+	return addressed(v).Interface().(QueryValueMarshaler).MarshalQueryValue()
+}
+
+func formatText(e *encoder, v reflect.Value) (string, error) {
+	b, err := addressed(v).Interface().(encoding.TextMarshaler).MarshalText()
+	return string(b), err
+}
+
+func formatString(e *encoder, v reflect.Value) (string, error) {
+	return v.String(), nil
+}
+
+func formatBool(e *encoder, v reflect.Value) (string, error) {
+	return strconv.FormatBool(v.Bool()), nil
+}
+
+func formatInt(e *encoder, v reflect.Value) (string, error) {
+	return strconv.FormatInt(v.Int(), 10), nil
+}
+
+func formatUint(e *encoder, v reflect.Value) (string, error) {
+	return strconv.FormatUint(v.Uint(), 10), nil
+}
+
+func formatFloat(e *encoder, v reflect.Value) (string, error) {
+	return strconv.FormatFloat(v.Float(), 'G', -1, 64), nil
+}
+
+func formatTime(e *encoder, v reflect.Value) (string, error) {
+	return v.Interface().(time.Time).Format(e.opts.timeLayout()), nil
+}
+
+func formatComparativeTime(e *encoder, v reflect.Value) (string, error) {
+	c := v.Interface().(ComparativeTime)
+	return c.Operator + c.Time.Format(e.opts.timeLayout()), nil
+}
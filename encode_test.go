@@ -1,7 +1,11 @@
 package qstring
 
 import (
+	"errors"
+	"math/big"
+	"net"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -294,3 +298,228 @@ func TestMarshaller(t *testing.T) {
 		}
 	}
 }
+
+func TestMarshalRemain(t *testing.T) {
+	type Query struct {
+		Name   string
+		Extras map[string][]string `qstring:",remain"`
+	}
+
+	q := &Query{
+		Name: "SomeName",
+		Extras: map[string][]string{
+			"status": []string{"open", "closed"},
+			"name":   []string{"ignored"},
+		},
+	}
+
+	values, err := Marshal(q)
+	if err != nil {
+		t.Fatalf("Unable to marshal remain field: %s", err.Error())
+	}
+
+	if values.Get("name") != "SomeName" {
+		t.Errorf("Expected remain field not to override name, got %q", values["name"])
+	}
+
+	if len(values["status"]) != 2 {
+		t.Errorf("Expected status to be merged from remain field, got %q", values)
+	}
+
+	if _, ok := values["extras"]; ok {
+		t.Errorf("Remain field was included in %q", values)
+	}
+
+	var roundTrip Query
+	if err = Unmarshal(values, &roundTrip); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if len(roundTrip.Extras["status"]) != 2 {
+		t.Errorf("Expected remain field to round trip, got %q", roundTrip.Extras)
+	}
+}
+
+func TestMarshalRemainSliceElement(t *testing.T) {
+	type Item struct {
+		SKU  string
+		Rest url.Values `qstring:",remain"`
+	}
+	type Query struct {
+		Items []Item
+	}
+
+	values, err := Marshal(&Query{Items: []Item{{SKU: "a", Rest: url.Values{"other": {"x"}}}}})
+	if err != nil {
+		t.Fatalf("Unable to marshal slice of structs: %s", err.Error())
+	}
+
+	expected := url.Values{"items[0][sku]": {"a"}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected remain field within slice element to be ignored, got %q", values)
+	}
+}
+
+func TestMarshalQueryValue(t *testing.T) {
+	q := &StatusQuery{
+		Status:   StatusOpen,
+		Statuses: []OrderStatus{StatusOpen, StatusClosed},
+	}
+
+	values, err := Marshal(q)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if values.Get("status") != "open" {
+		t.Errorf("Expected status=open, got %q", values["status"])
+	}
+
+	statuses := values["statuses"]
+	if len(statuses) != 2 || statuses[1] != "closed" {
+		t.Errorf("Expected statuses [open closed], got %q", statuses)
+	}
+
+	q.Status = 0
+	if _, err = Marshal(q); !errors.Is(err, errUnknownStatus) {
+		t.Errorf("Expected %v, got %v", errUnknownStatus, err)
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	type Query struct {
+		Addr  net.IP
+		Addrs []net.IP
+		Count big.Int
+	}
+
+	q := &Query{
+		Addr:  net.ParseIP("10.0.0.1"),
+		Addrs: []net.IP{net.ParseIP("10.0.0.2"), net.IPv6loopback},
+	}
+	q.Count.SetInt64(42)
+
+	values, err := Marshal(q)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := url.Values{
+		"addr":  []string{"10.0.0.1"},
+		"addrs": []string{"10.0.0.2", "::1"},
+		"count": []string{"42"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+}
+
+func TestMarshalPointers(t *testing.T) {
+	type Query struct {
+		Name    *string
+		Limit   *int
+		Do      *bool
+		Created *time.Time
+		IDs     []*int
+		Paging  *struct{ Page int }
+	}
+
+	name, limit, id := "", 0, 7
+	created, _ := time.Parse(time.RFC3339, "2006-01-02T15:04:05Z")
+	q := &Query{Name: &name, Limit: &limit, Created: &created,
+		IDs: []*int{&id, nil}}
+
+	values, err := Marshal(q)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := url.Values{
+		"name":    []string{""},
+		"limit":   []string{"0"},
+		"created": []string{"2006-01-02T15:04:05Z"},
+		"ids":     []string{"7"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+}
+
+func TestMarshalAliases(t *testing.T) {
+	type Query struct {
+		Limit int `qstring:"limit,alias=per_page|count"`
+	}
+
+	values, err := Marshal(&Query{Limit: 10})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := url.Values{"limit": []string{"10"}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+}
+
+func TestMarshalMaps(t *testing.T) {
+	type Query struct {
+		Meta  map[string]string
+		Tags  map[string][]int
+		Empty map[string]string `qstring:"empty,omitempty"`
+	}
+
+	params := &Query{
+		Meta: map[string]string{"size": "large", "color": "red"},
+		Tags: map[string][]int{"b": {1, 2}},
+	}
+
+	result, err := MarshalString(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := "meta%5Bcolor%5D=red&meta%5Bsize%5D=large&tags%5Bb%5D=1&tags%5Bb%5D=2"
+	if result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+
+	values, err := NewEncoder(Nesting(DottedNesting)).Marshal(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if values.Get("meta.color") != "red" || len(values["tags.b"]) != 2 {
+		t.Errorf("Unexpected dotted values %q", values)
+	}
+}
+
+// Grade marshals itself through a method with a pointer receiver
+type Grade int
+
+func (g *Grade) MarshalQueryValue() (string, error) {
+	return string(rune('A' + *g)), nil
+}
+
+func TestMarshalMapPointerReceivers(t *testing.T) {
+	type Query struct {
+		Grades  map[string]Grade
+		Amounts map[string]big.Int
+	}
+
+	params := &Query{
+		Grades:  map[string]Grade{"math": 0, "art": 2},
+		Amounts: map[string]big.Int{"total": *big.NewInt(42)},
+	}
+
+	values, err := Marshal(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := url.Values{
+		"grades[art]":    []string{"C"},
+		"grades[math]":   []string{"A"},
+		"amounts[total]": []string{"42"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+}
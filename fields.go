@@ -45,6 +45,14 @@ func NewComparativeTime() *ComparativeTime {
 
 // Parse is used to parse a query string into a ComparativeTime instance
 func (c *ComparativeTime) Parse(query string) error {
+	return c.parse(query, func(s string) (time.Time, error) {
+		return time.Parse(time.RFC3339, s)
+	})
+}
+
+// parse parses a query string into a ComparativeTime instance, using the
+// provided func to parse the timestamp which follows the operator
+func (c *ComparativeTime) parse(query string, parseTime func(string) (time.Time, error)) error {
 	if len(query) <= 2 {
 		return errors.New("qstring: Invalid Timestamp Query")
 	}
@@ -57,7 +65,7 @@ func (c *ComparativeTime) Parse(query string) error {
 	}
 
 	var err error
-	c.Time, err = time.Parse(time.RFC3339, query[len(c.Operator):])
+	c.Time, err = parseTime(query[len(c.Operator):])
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,62 @@
+package qstring
+
+import (
+	"net/url"
+	"reflect"
+)
+
+// An InvalidTypeError describes a type argument passed to Decode or Encode
+// which is neither a struct nor a pointer to a struct
+type InvalidTypeError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidTypeError) Error() string {
+	return "qstring: " + e.Type.String() + " is not a struct or pointer to a struct"
+}
+
+// structType returns the struct type T refers to, and whether T is a pointer
+// to it. A nil type is returned if T is neither a struct nor a pointer to one
+func structType[T any]() (reflect.Type, bool) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	switch {
+	case t.Kind() == reflect.Struct:
+		return t, false
+	case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct:
+		return t.Elem(), true
+	}
+	return nil, false
+}
+
+// Decode unmarshals the provided url.Values into a new value of type T, which
+// must be a struct or a pointer to a struct
+func Decode[T any](data url.Values) (T, error) {
+	var v T
+	st, ptr := structType[T]()
+	if st == nil {
+		return v, &InvalidTypeError{reflect.TypeOf((*T)(nil)).Elem()}
+	}
+
+	if !ptr {
+		err := Unmarshal(data, &v)
+		return v, err
+	}
+
+	rv := reflect.New(st)
+	reflect.ValueOf(&v).Elem().Set(rv)
+	return v, Unmarshal(data, rv.Interface())
+}
+
+// Encode marshals the provided value, which must be a struct or a non-nil
+// pointer to a struct, into a url.Values collection
+func Encode[T any](v T) (url.Values, error) {
+	st, ptr := structType[T]()
+	if st == nil {
+		return nil, &InvalidTypeError{reflect.TypeOf((*T)(nil)).Elem()}
+	}
+
+	if !ptr {
+		return Marshal(&v)
+	}
+	return Marshal(v)
+}
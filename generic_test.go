@@ -0,0 +1,79 @@
+package qstring
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type GenericQuery struct {
+	Names []string
+	Limit int
+}
+
+func TestDecode(t *testing.T) {
+	query := url.Values{
+		"names": []string{"foo", "bar"},
+		"limit": []string{"50"},
+	}
+	expected := GenericQuery{Names: []string{"foo", "bar"}, Limit: 50}
+
+	q, err := Decode[GenericQuery](query)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(q, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, q)
+	}
+
+	p, err := Decode[*GenericQuery](query)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if p == nil || !reflect.DeepEqual(*p, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, p)
+	}
+
+	_, err = Decode[GenericQuery](url.Values{"limit": []string{"x"}})
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("Expected *UnmarshalTypeError, got %v", err)
+	}
+
+	var invalid *InvalidTypeError
+	if _, err = Decode[int](query); !errors.As(err, &invalid) {
+		t.Errorf("Expected *InvalidTypeError, got %v", err)
+	}
+	if _, err = Decode[*[]string](query); !errors.As(err, &invalid) {
+		t.Errorf("Expected *InvalidTypeError, got %v", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	q := GenericQuery{Names: []string{"foo"}, Limit: 50}
+	expected := url.Values{"names": []string{"foo"}, "limit": []string{"50"}}
+
+	values, err := Encode(q)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+
+	if values, err = Encode(&q); err != nil || !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q and %v", expected, values, err)
+	}
+
+	var nilQuery *GenericQuery
+	var invalidMarshal *InvalidMarshalError
+	if _, err = Encode(nilQuery); !errors.As(err, &invalidMarshal) {
+		t.Errorf("Expected *InvalidMarshalError, got %v", err)
+	}
+
+	var invalid *InvalidTypeError
+	if _, err = Encode("names=foo"); !errors.As(err, &invalid) {
+		t.Errorf("Expected *InvalidTypeError, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package qstring
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A NamingStrategy derives the query parameter key of a struct field whose tag
+// does not provide a name from the field's Go name. Any func with the same
+// signature may be used, alongside the strategies provided by this package
+type NamingStrategy func(field string) string
+
+// Lowercase lowercases the field name, such that PageSize becomes pagesize.
+// This is the default naming strategy
+func Lowercase(field string) string {
+	return strings.ToLower(field)
+}
+
+// Exact uses the field name unchanged, such that PageSize remains PageSize
+func Exact(field string) string {
+	return field
+}
+
+// SnakeCase lowercases each word of the field name and joins them with
+// underscores, such that PageSize becomes page_size and UserID becomes user_id
+func SnakeCase(field string) string {
+	return joinWords(splitWords(field), "_")
+}
+
+// KebabCase lowercases each word of the field name and joins them with
+// hyphens, such that PageSize becomes page-size and UserID becomes user-id
+func KebabCase(field string) string {
+	return joinWords(splitWords(field), "-")
+}
+
+// CamelCase lowercases the first word of the field name, such that PageSize
+// becomes pageSize, HTTPServer becomes httpServer and IDs becomes ids
+func CamelCase(field string) string {
+	words := splitWords(field)
+	if len(words) == 0 {
+		return field
+	}
+	words[0] = strings.ToLower(words[0])
+	return strings.Join(words, "")
+}
+
+// joinWords lowercases each of the provided words and joins them with sep
+func joinWords(words []string, sep string) string {
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+	return strings.Join(words, sep)
+}
+
+// splitWords splits a Go identifier into its words. A new word begins at an
+// upper case letter following a lower case letter or digit, and at the last
+// letter of an acronym followed by a lower case letter, such that HTTPServer
+// splits into HTTP and Server. Acronyms pluralised with a trailing s, such as
+// IDs, are kept whole
+func splitWords(name string) []string {
+	runes := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if !unicode.IsUpper(runes[i]) {
+			continue
+		}
+
+		prev := runes[i-1]
+		switch {
+		case unicode.IsLower(prev) || unicode.IsDigit(prev):
+		case unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) &&
+			!isPluralAcronym(runes, i+1):
+		default:
+			continue
+		}
+		words = append(words, string(runes[start:i]))
+		start = i
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// isPluralAcronym returns true if the rune at i is an s ending the word, which
+// pluralises the acronym preceding it
+func isPluralAcronym(runes []rune, i int) bool {
+	return runes[i] == 's' && (i+1 == len(runes) || !unicode.IsLower(runes[i+1]))
+}
@@ -0,0 +1,90 @@
+package qstring
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNamingStrategies(t *testing.T) {
+	var testio = []struct {
+		field string
+		snake string
+		kebab string
+		camel string
+		lower string
+	}{
+		{"PageSize", "page_size", "page-size", "pageSize", "pagesize"},
+		{"UserID", "user_id", "user-id", "userID", "userid"},
+		{"IDs", "ids", "ids", "ids", "ids"},
+		{"UserIDs", "user_ids", "user-ids", "userIDs", "userids"},
+		{"HTTPServer", "http_server", "http-server", "httpServer", "httpserver"},
+		{"Page2Size", "page2_size", "page2-size", "page2Size", "page2size"},
+		{"Limit", "limit", "limit", "limit", "limit"},
+		{"A", "a", "a", "a", "a"},
+	}
+
+	for _, test := range testio {
+		if got := SnakeCase(test.field); got != test.snake {
+			t.Errorf("SnakeCase(%q): expected %q, got %q", test.field, test.snake, got)
+		}
+		if got := KebabCase(test.field); got != test.kebab {
+			t.Errorf("KebabCase(%q): expected %q, got %q", test.field, test.kebab, got)
+		}
+		if got := CamelCase(test.field); got != test.camel {
+			t.Errorf("CamelCase(%q): expected %q, got %q", test.field, test.camel, got)
+		}
+		if got := Lowercase(test.field); got != test.lower {
+			t.Errorf("Lowercase(%q): expected %q, got %q", test.field, test.lower, got)
+		}
+		if got := Exact(test.field); got != test.field {
+			t.Errorf("Exact(%q): expected %q, got %q", test.field, test.field, got)
+		}
+	}
+}
+
+func TestKeyNaming(t *testing.T) {
+	type Query struct {
+		PageSize int
+		UserIDs  []int
+		Sort     string `qstring:"order"`
+	}
+
+	var testio = []struct {
+		strategy NamingStrategy
+		keys     []string
+	}{
+		{SnakeCase, []string{"order", "page_size", "user_ids"}},
+		{CamelCase, []string{"order", "pageSize", "userIDs"}},
+		{KebabCase, []string{"order", "page-size", "user-ids"}},
+		{Exact, []string{"PageSize", "UserIDs", "order"}},
+		{strings.ToUpper, []string{"PAGESIZE", "USERIDS", "order"}},
+	}
+
+	params := &Query{PageSize: 10, UserIDs: []int{1, 2}, Sort: "name"}
+	for _, test := range testio {
+		values, err := NewEncoder(KeyNaming(test.strategy)).Marshal(params)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		var keys []string
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("Expected keys %v, got %v", test.keys, keys)
+		}
+
+		decoded := &Query{}
+		err = NewDecoder(KeyNaming(test.strategy)).Unmarshal(values, decoded)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !reflect.DeepEqual(decoded, params) {
+			t.Errorf("Expected %+v to round trip, got %+v", params, decoded)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package qstring
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A NestingStyle determines how the query parameter keys of nested struct
+// fields are derived
+type NestingStyle int
+
+const (
+	// FlatNesting keys the fields of nested structs as though they belonged to
+	// the parent struct, merging their parameters. This is the default
+	FlatNesting NestingStyle = iota
+	// BracketNesting keys the fields of nested structs within brackets after
+	// the key of the nested struct, such as filter[status], to any depth
+	BracketNesting
+	// DottedNesting keys the fields of nested structs after the key of the
+	// nested struct and a separator, such as page.size, to any depth. The
+	// separator defaults to "." and is set with the NestingSeparator option
+	DottedNesting
+)
+
+// Nesting sets the style used to key the fields of nested structs. Nested
+// structs tagged with the prefix option are keyed as though DottedNesting was
+// used when the style is FlatNesting
+func Nesting(style NestingStyle) Option {
+	return func(o *options) {
+		o.nesting = style
+	}
+}
+
+// NestingSeparator sets the separator placed between the key of a nested struct
+// and the keys of its fields by DottedNesting and the prefix tag option
+func NestingSeparator(sep string) Option {
+	return func(o *options) {
+		o.separator = sep
+	}
+}
+
+// nestedPrefix returns the key prefix for the fields of the nested struct field
+// f, whose parent's fields are prefixed with prefix. As with encoding/json, the
+// fields of untagged embedded structs are keyed as those of the parent
+func (o *options) nestedPrefix(prefix string, f *field) string {
+	if f.embedded || (o.nesting == FlatNesting && !f.opts.prefix) {
+		return prefix
+	}
+	return o.nestKey(prefix, f.key)
+}
+
+// brackets returns true if keys nested within the key prefix are enclosed in
+// brackets. Besides BracketNesting, this is the case within the elements of a
+// slice of structs, such as items[0][sku], unless DottedNesting is used
+func (o *options) brackets(prefix string) bool {
+	switch o.nesting {
+	case BracketNesting:
+		return true
+	case DottedNesting:
+		return false
+	}
+	return prefix[len(prefix)-1] == ']'
+}
+
+// indexKey returns the key prefix for the fields of the element at index i of
+// the slice of structs keyed key
+func indexKey(key string, i int) string {
+	return key + "[" + strconv.Itoa(i) + "]"
+}
+
+// mapKey returns the key of the entry name of the map keyed key, which is
+// meta.color for DottedNesting and meta[color] otherwise
+func (o *options) mapKey(key, name string) string {
+	if o.nesting != DottedNesting {
+		return key + "[" + name + "]"
+	}
+	if o.separator == "" {
+		return key + "." + name
+	}
+	return key + o.separator + name
+}
+
+// nestKey returns the provided key nested within the key prefix. A key which is
+// itself nested with brackets, such as status[eq], is nested as
+// filter[status][eq]
+func (o *options) nestKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	if !o.brackets(prefix) {
+		if o.separator == "" {
+			return prefix + "." + key
+		}
+		return prefix + o.separator + key
+	}
+	if i := strings.IndexByte(key, '['); i > 0 {
+		return prefix + "[" + key[:i] + "]" + key[i:]
+	}
+	return prefix + "[" + key + "]"
+}
@@ -0,0 +1,402 @@
+package qstring
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type DateRange struct {
+	From string
+	To   string
+}
+
+type Filter struct {
+	Status  string
+	Name    string
+	Created DateRange
+}
+
+type Page struct {
+	Number int
+	Size   int
+}
+
+type NestingQuery struct {
+	Name   string
+	Filter Filter
+	Page   *Page
+}
+
+func TestUnmarshalBracketNesting(t *testing.T) {
+	query := url.Values{
+		"name":                  []string{"outer"},
+		"filter[status]":        []string{"open"},
+		"filter[name]":          []string{"inner"},
+		"filter[created][from]": []string{"2020"},
+		"page[size]":            []string{"10"},
+	}
+
+	params := &NestingQuery{}
+	dec := NewDecoder(Nesting(BracketNesting), DisallowUnknownKeys())
+	if err := dec.Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := &NestingQuery{
+		Name: "outer",
+		Filter: Filter{
+			Status:  "open",
+			Name:    "inner",
+			Created: DateRange{From: "2020"},
+		},
+		Page: &Page{Size: 10},
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, params)
+	}
+
+	// flattened keys are not recognised when nesting with brackets
+	err := dec.Unmarshal(url.Values{"status": []string{"open"}}, &NestingQuery{})
+	var unknown *UnknownKeysError
+	if !errors.As(err, &unknown) {
+		t.Errorf("Expected *UnknownKeysError, got %v", err)
+	}
+
+	err = dec.Unmarshal(url.Values{"page[size]": []string{"big"}}, &NestingQuery{})
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Key != "page[size]" || typeErr.Field != "Page.Size" {
+		t.Errorf("Expected an UnmarshalTypeError for page[size], got %v", err)
+	}
+}
+
+func TestMarshalBracketNesting(t *testing.T) {
+	params := &NestingQuery{
+		Name: "outer",
+		Filter: Filter{
+			Status:  "open",
+			Name:    "inner",
+			Created: DateRange{From: "2020", To: "2021"},
+		},
+	}
+
+	values, err := NewEncoder(Nesting(BracketNesting)).Marshal(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := url.Values{
+		"name":                  []string{"outer"},
+		"filter[status]":        []string{"open"},
+		"filter[name]":          []string{"inner"},
+		"filter[created][from]": []string{"2020"},
+		"filter[created][to]":   []string{"2021"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+
+	decoded := &NestingQuery{}
+	if err = NewDecoder(Nesting(BracketNesting)).Unmarshal(values, decoded); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(decoded, params) {
+		t.Errorf("Expected %+v to round trip, got %+v", params, decoded)
+	}
+}
+
+type nestedMarshaller struct{}
+
+func (m *nestedMarshaller) MarshalQuery() (url.Values, error) {
+	return url.Values{"status": []string{"open"}, "tags[any]": []string{"a"}}, nil
+}
+
+func TestMarshalBracketNestingMarshaller(t *testing.T) {
+	type Query struct {
+		Filter nestedMarshaller
+	}
+
+	values, err := NewEncoder(Nesting(BracketNesting)).Marshal(&Query{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := url.Values{
+		"filter[status]":    []string{"open"},
+		"filter[tags][any]": []string{"a"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+}
+
+func TestDottedNesting(t *testing.T) {
+	query := url.Values{
+		"name":                []string{"outer"},
+		"filter.status":       []string{"open"},
+		"filter.created.from": []string{"2020"},
+		"page.size":           []string{"10"},
+		"page.number":         []string{"2"},
+	}
+
+	params := &NestingQuery{}
+	dec := NewDecoder(Nesting(DottedNesting), DisallowUnknownKeys())
+	if err := dec.Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := &NestingQuery{
+		Name:   "outer",
+		Filter: Filter{Status: "open", Created: DateRange{From: "2020"}},
+		Page:   &Page{Number: 2, Size: 10},
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, params)
+	}
+
+	values, err := NewEncoder(Nesting(DottedNesting), NestingSeparator("_")).Marshal(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expectedValues := url.Values{
+		"name":                []string{"outer"},
+		"filter_status":       []string{"open"},
+		"filter_name":         []string{""},
+		"filter_created_from": []string{"2020"},
+		"filter_created_to":   []string{""},
+		"page_size":           []string{"10"},
+		"page_number":         []string{"2"},
+	}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Errorf("Expected %q, got %q", expectedValues, values)
+	}
+}
+
+func TestEmbeddedNesting(t *testing.T) {
+	type Query struct {
+		Page
+		*DateRange
+		Name   string
+		Filter DateRange `qstring:"filter"`
+	}
+
+	query := url.Values{
+		"number":       []string{"2"},
+		"size":         []string{"10"},
+		"from":         []string{"2020"},
+		"name":         []string{"outer"},
+		"filter[from]": []string{"2021"},
+	}
+	expected := &Query{
+		Page:      Page{Number: 2, Size: 10},
+		DateRange: &DateRange{From: "2020"},
+		Name:      "outer",
+		Filter:    DateRange{From: "2021"},
+	}
+
+	for _, style := range []NestingStyle{FlatNesting, BracketNesting} {
+		params := &Query{}
+		dec := NewDecoder(Nesting(style))
+		if err := dec.Unmarshal(query, params); err != nil {
+			t.Fatal(err.Error())
+		}
+		if style == BracketNesting && !reflect.DeepEqual(params, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, params)
+		}
+		if params.Number != 2 || params.From != "2020" {
+			t.Errorf("Expected embedded fields to be promoted with style %d, got %+v", style, params)
+		}
+	}
+
+	values, err := NewEncoder(Nesting(BracketNesting)).Marshal(expected)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectedValues := url.Values{
+		"number":       []string{"2"},
+		"size":         []string{"10"},
+		"from":         []string{"2020"},
+		"to":           []string{""},
+		"name":         []string{"outer"},
+		"filter[from]": []string{"2021"},
+		"filter[to]":   []string{""},
+	}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Errorf("Expected %q, got %q", expectedValues, values)
+	}
+}
+
+func TestPrefixTag(t *testing.T) {
+	type Author struct {
+		Name string
+	}
+	type Query struct {
+		Name   string
+		Author Author `qstring:"author,prefix"`
+		Page   Page   `qstring:"page,prefix"`
+		Sort   struct {
+			Field string
+		}
+	}
+
+	query := url.Values{
+		"name":        []string{"book"},
+		"author.name": []string{"someone"},
+		"page.size":   []string{"10"},
+		"field":       []string{"title"},
+	}
+
+	params := &Query{}
+	if err := NewDecoder(DisallowUnknownKeys()).Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+	if params.Name != "book" || params.Author.Name != "someone" ||
+		params.Page.Size != 10 || params.Sort.Field != "title" {
+		t.Errorf("Unexpected params %+v", params)
+	}
+
+	values, err := Marshal(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := url.Values{
+		"name":        []string{"book"},
+		"author.name": []string{"someone"},
+		"page.number": []string{"0"},
+		"page.size":   []string{"10"},
+		"field":       []string{"title"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+
+	// prefixed structs are keyed within brackets when nesting with brackets
+	values, err = NewEncoder(Nesting(BracketNesting)).Marshal(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if values.Get("author[name]") != "someone" || values.Get("sort[field]") != "title" {
+		t.Errorf("Unexpected bracket nested values %q", values)
+	}
+}
+
+type LineItem struct {
+	SKU string `qstring:"sku"`
+	Qty int    `qstring:"qty"`
+}
+
+type OrderQuery struct {
+	Items    []LineItem
+	Refunds  []*LineItem
+	Customer string
+}
+
+func TestUnmarshalStructSlice(t *testing.T) {
+	query := url.Values{
+		"items[0][sku]":   []string{"a"},
+		"items[0][qty]":   []string{"2"},
+		"items[1][sku]":   []string{"b"},
+		"refunds[7][sku]": []string{"c"},
+		"customer":        []string{"someone"},
+	}
+
+	params := &OrderQuery{}
+	if err := NewDecoder(DisallowUnknownKeys()).Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := &OrderQuery{
+		Items:    []LineItem{{SKU: "a", Qty: 2}, {SKU: "b"}},
+		Refunds:  []*LineItem{{SKU: "c"}},
+		Customer: "someone",
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, params)
+	}
+
+	err := Unmarshal(url.Values{"items[1][qty]": []string{"x"}}, &OrderQuery{})
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Key != "items[1][qty]" || typeErr.Field != "Items[0].Qty" {
+		t.Errorf("Expected an UnmarshalTypeError for items[1][qty], got %v", err)
+	}
+
+	// keys which are not canonical indices are left unknown
+	err = NewDecoder(DisallowUnknownKeys()).Unmarshal(url.Values{
+		"items[01][sku]": []string{"a"},
+		"items[-1][sku]": []string{"a"},
+		"items[x][sku]":  []string{"a"},
+	}, &OrderQuery{})
+	var unknown *UnknownKeysError
+	if !errors.As(err, &unknown) || len(unknown.Keys) != 3 {
+		t.Errorf("Expected three unknown keys, got %v", err)
+	}
+}
+
+func TestUnmarshalStructSliceLimits(t *testing.T) {
+	var testio = []struct {
+		dec   *Decoder
+		query url.Values
+		err   *LimitError
+	}{
+		{NewDecoder(), url.Values{"items[1000][sku]": []string{"a"}}, nil},
+		{NewDecoder(), url.Values{"items[1001][sku]": []string{"a"}},
+			&LimitError{Key: "items", Limit: "slice index", Max: 1000}},
+		{NewDecoder(), url.Values{"items[99999999999999999999][sku]": []string{"a"}},
+			&LimitError{Key: "items", Limit: "slice index", Max: 1000}},
+		{NewDecoder(MaxSliceIndex(5)), url.Values{"items[6][sku]": []string{"a"}},
+			&LimitError{Key: "items", Limit: "slice index", Max: 5}},
+		{NewDecoder(MaxSliceLength(1)), url.Values{"items[0][sku]": []string{"a"}, "items[1][sku]": []string{"b"}},
+			&LimitError{Key: "items", Limit: "slice length", Max: 1}},
+	}
+
+	for _, test := range testio {
+		params := &OrderQuery{}
+		err := test.dec.Unmarshal(test.query, params)
+		if test.err == nil {
+			if err != nil || len(params.Items) != 1 {
+				t.Errorf("Expected a single item, got %+v (%v)", params.Items, err)
+			}
+			continue
+		}
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || *limitErr != *test.err {
+			t.Errorf("Expected %+v, got %v", test.err, err)
+		}
+	}
+}
+
+func TestMarshalStructSlice(t *testing.T) {
+	params := &OrderQuery{
+		Items:   []LineItem{{SKU: "a", Qty: 2}, {SKU: "b", Qty: 1}},
+		Refunds: []*LineItem{nil, {SKU: "c", Qty: 1}},
+	}
+
+	values, err := Marshal(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := url.Values{
+		"items[0][sku]":   []string{"a"},
+		"items[0][qty]":   []string{"2"},
+		"items[1][sku]":   []string{"b"},
+		"items[1][qty]":   []string{"1"},
+		"refunds[1][sku]": []string{"c"},
+		"refunds[1][qty]": []string{"1"},
+		"customer":        []string{""},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+
+	values, err = NewEncoder(Nesting(DottedNesting)).Marshal(&OrderQuery{Items: params.Items[:1]})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if values.Get("items[0].sku") != "a" || values.Get("items[0].qty") != "2" {
+		t.Errorf("Unexpected dotted values %q", values)
+	}
+}
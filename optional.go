@@ -0,0 +1,60 @@
+package qstring
+
+import "reflect"
+
+// Optional is a field type which records whether its query parameter was
+// provided. Set is true whenever the parameter is present, while Empty is also
+// true if it was present without a value, such as "?q=". Value holds the
+// unmarshaled value for any other type supported by qstring, or the default
+// declared in its tag when the parameter is absent.
+//
+// When marshaling, unset Optionals are omitted and empty Optionals are written
+// with an empty value
+type Optional[T any] struct {
+	Value T
+	Set   bool
+	Empty bool
+}
+
+// NewOptional returns a set Optional holding the provided value
+func NewOptional[T any](v T) Optional[T] {
+	return Optional[T]{Value: v, Set: true}
+}
+
+// Get returns the held value and whether the parameter was provided with a
+// value
+func (o Optional[T]) Get() (T, bool) {
+	return o.Value, o.Set && !o.Empty
+}
+
+func (Optional[T]) isOptional() {}
+
+// optional is implemented by every instantiation of Optional, allowing them to
+// be recognised through reflection
+type optional interface {
+	isOptional()
+}
+
+// indices of the Optional fields, as accessed through reflection
+const (
+	optionalValue = iota
+	optionalSet
+	optionalEmpty
+)
+
+var optionalType = reflect.TypeOf((*optional)(nil)).Elem()
+
+// isOptional returns true if t is an instantiation of Optional
+func isOptional(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.Implements(optionalType)
+}
+
+// valueType returns the type ultimately coerced from query parameters for a
+// field of type t, looking through pointers and Optionals
+func valueType(t reflect.Type) reflect.Type {
+	t = indirectType(t)
+	if isOptional(t) {
+		t = indirectType(t.Field(optionalValue).Type)
+	}
+	return t
+}
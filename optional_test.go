@@ -0,0 +1,94 @@
+package qstring
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type OptionalQuery struct {
+	Search  Optional[string]    `qstring:"q"`
+	Limit   Optional[int]       `qstring:"limit,min=1"`
+	IDs     Optional[[]int]     `qstring:"ids"`
+	Created Optional[time.Time] `qstring:"created"`
+}
+
+func TestUnmarshalOptional(t *testing.T) {
+	query := url.Values{
+		"q":     []string{""},
+		"limit": []string{""},
+		"ids":   []string{"1", "2"},
+	}
+
+	params := &OptionalQuery{}
+	if err := Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := OptionalQuery{
+		Search: Optional[string]{Set: true, Empty: true},
+		Limit:  Optional[int]{Set: true, Empty: true},
+		IDs:    NewOptional([]int{1, 2}),
+	}
+	if !reflect.DeepEqual(*params, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, *params)
+	}
+
+	if _, ok := params.Search.Get(); ok {
+		t.Errorf("Expected empty search not to hold a value")
+	}
+
+	if err := Unmarshal(url.Values{"limit": []string{"0"}}, params); err == nil {
+		t.Errorf("Expected optional limit to be validated")
+	}
+}
+
+func TestUnmarshalOptionalDefault(t *testing.T) {
+	type Query struct {
+		Search Optional[string] `qstring:"q,default=x"`
+		Limit  Optional[int]    `qstring:"limit,default=10"`
+	}
+
+	params := &Query{}
+	if err := Unmarshal(url.Values{"limit": []string{"5"}}, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := Query{
+		Search: Optional[string]{Value: "x"},
+		Limit:  NewOptional(5),
+	}
+	if !reflect.DeepEqual(*params, expected) {
+		t.Errorf("Expected default to leave Optional unset, got %+v", *params)
+	}
+}
+
+func TestMarshalOptional(t *testing.T) {
+	q := &OptionalQuery{
+		Search: Optional[string]{Set: true, Empty: true},
+		Limit:  NewOptional(5),
+	}
+
+	values, err := Marshal(q)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := url.Values{
+		"q":     []string{""},
+		"limit": []string{"5"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+
+	var roundTrip OptionalQuery
+	if err = Unmarshal(values, &roundTrip); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if !reflect.DeepEqual(roundTrip, *q) {
+		t.Errorf("Expected %+v to round trip, got %+v", *q, roundTrip)
+	}
+}
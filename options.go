@@ -0,0 +1,237 @@
+package qstring
+
+import (
+	"reflect"
+	"time"
+)
+
+// An Option configures the behaviour of a Decoder or Encoder. Options which
+// only concern unmarshalling have no effect on an Encoder
+type Option func(*options)
+
+// options holds the settings shared by every marshal or unmarshal performed
+// through an Encoder or Decoder. Once the Encoder or Decoder has been created
+// its options are never modified, making them safe for concurrent use
+type options struct {
+	collectErrors        bool
+	disallowUnknownKeys  bool
+	disallowRepeatedKeys bool
+	caseInsensitiveKeys  bool
+	converters           map[reflect.Type]converter
+	onDeprecated         func(Deprecation)
+
+	tagNames       []string
+	naming         NamingStrategy
+	timeLayouts    []string
+	sliceDelimiter string
+	nesting        NestingStyle
+	separator      string
+	maxSliceLen    int
+	maxSliceIndex  int
+	maxParams      int
+
+	// cache holds the field plans compiled for the tag name and naming of
+	// these options, nil when they match the package defaults
+	cache *typeCache
+}
+
+// apply configures the options with each of the provided Options, giving the
+// options a field cache of their own if they change how keys are derived
+func (o *options) apply(opts []Option) {
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.tagNames != nil || o.naming != nil {
+		o.cache = new(typeCache)
+	}
+}
+
+// CollectErrors instructs the Decoder to continue decoding the remaining
+// fields when a query parameter fails to unmarshal, returning every failure
+// together as DecodeErrors
+func CollectErrors() Option {
+	return func(o *options) {
+		o.collectErrors = true
+	}
+}
+
+// DisallowUnknownKeys causes the Decoder to return an UnknownKeysError when the
+// query string contains keys which do not map to any field of the destination
+// struct, including the fields of nested structs
+func DisallowUnknownKeys() Option {
+	return func(o *options) {
+		o.disallowUnknownKeys = true
+	}
+}
+
+// DisallowRepeatedKeys causes the Decoder to return an UnmarshalTypeError
+// wrapping ErrRepeatedKey when a parameter destined for a single valued field
+// is provided more than once, rather than using its first value
+func DisallowRepeatedKeys() Option {
+	return func(o *options) {
+		o.disallowRepeatedKeys = true
+	}
+}
+
+// CaseInsensitiveKeys causes the Decoder to match query parameter keys to
+// fields regardless of case, such that ?Limit=1 and ?LIMIT=1 both populate a
+// field keyed limit. A key matching exactly takes precedence over one differing
+// in case, after which keys are considered in sorted order
+func CaseInsensitiveKeys() Option {
+	return func(o *options) {
+		o.caseInsensitiveKeys = true
+	}
+}
+
+// OnDeprecated sets a func called by the Decoder for each parameter of a field
+// tagged with the deprecated option which is present in the query string. It
+// is called from the goroutine performing the unmarshal, once decoding is
+// complete
+func OnDeprecated(fn func(Deprecation)) Option {
+	return func(o *options) {
+		o.onDeprecated = fn
+	}
+}
+
+// TagName sets the name of the struct tag consulted for field names and
+// options, in place of Tag
+func TagName(name string) Option {
+	return TagNames(name)
+}
+
+// TagNames sets the names of the struct tags consulted for field names and
+// options, in place of Tag. The first of the tags present on a field is used,
+// along with its own options, such that TagNames("qstring", "form", "json")
+// falls back to a field's json tag when it has neither a qstring nor a form tag
+func TagNames(names ...string) Option {
+	return func(o *options) {
+		o.tagNames = names
+	}
+}
+
+// KeyNaming sets the strategy used to derive the query parameter key of fields
+// whose tag does not provide a name, such as SnakeCase or CamelCase. The
+// strategy is applied by both the Decoder and Encoder, and defaults to
+// Lowercase
+func KeyNaming(strategy NamingStrategy) Option {
+	return func(o *options) {
+		o.naming = strategy
+	}
+}
+
+// TimeLayouts sets the layouts used for time.Time and ComparativeTime values.
+// Unmarshalling tries each layout in turn, while marshalling uses the first.
+// By default only time.RFC3339 is used
+func TimeLayouts(layouts ...string) Option {
+	return func(o *options) {
+		o.timeLayouts = layouts
+	}
+}
+
+// SliceDelimiter causes slice fields to be unmarshalled from values joined by
+// sep, such as ?ids=1,2,3, in addition to repeated keys, and to be marshaled
+// as a single value joined by sep. A delimiter or backslash within an element
+// is escaped with a backslash, such as ?names=a\,b,c for "a,b" and "c". The
+// comma, pipe, space, tab and multi tag options override the delimiter for a
+// single field
+func SliceDelimiter(sep string) Option {
+	return func(o *options) {
+		o.sliceDelimiter = sep
+	}
+}
+
+// MaxSliceLength limits the number of values the Decoder accepts for a single
+// slice field, returning a LimitError when a query string exceeds it
+func MaxSliceLength(n int) Option {
+	return func(o *options) {
+		o.maxSliceLen = n
+	}
+}
+
+// defaultMaxSliceIndex is the largest index accepted in the indexed keys of a
+// slice of structs unless the MaxSliceIndex option is used
+const defaultMaxSliceIndex = 1000
+
+// MaxSliceIndex limits the index the Decoder accepts in the indexed keys of a
+// slice of structs, such as the 2 of items[2][sku], returning a LimitError when
+// a query string exceeds it. The limit defaults to 1000
+func MaxSliceIndex(n int) Option {
+	return func(o *options) {
+		o.maxSliceIndex = n
+	}
+}
+
+// MaxParameters limits the number of distinct query parameters the Decoder
+// accepts, returning a LimitError when a query string exceeds it
+func MaxParameters(n int) Option {
+	return func(o *options) {
+		o.maxParams = n
+	}
+}
+
+// tag returns the first of the struct tags consulted for fields which is
+// present in the provided field tag
+func (o *options) tag(st reflect.StructTag) string {
+	if o.tagNames == nil {
+		return st.Get(Tag)
+	}
+	for _, name := range o.tagNames {
+		if tag, ok := st.Lookup(name); ok {
+			return tag
+		}
+	}
+	return ""
+}
+
+// key returns the query parameter key for a field without a tagged name
+func (o *options) key(field string) string {
+	if o.naming == nil {
+		return Lowercase(field)
+	}
+	return o.naming(field)
+}
+
+// delimiter returns the delimiter joining the elements of the slice field
+// described by f, which is empty when elements are provided as repeated keys
+func (o *options) delimiter(f *field) string {
+	if f.opts.hasDelimiter {
+		return f.opts.delimiter
+	}
+	return o.sliceDelimiter
+}
+
+// sliceIndexLimit returns the largest index accepted for slices of structs
+func (o *options) sliceIndexLimit() int {
+	if o.maxSliceIndex == 0 {
+		return defaultMaxSliceIndex
+	}
+	return o.maxSliceIndex
+}
+
+// timeLayout returns the layout used to marshal times
+func (o *options) timeLayout() string {
+	if len(o.timeLayouts) == 0 {
+		return time.RFC3339
+	}
+	return o.timeLayouts[0]
+}
+
+// parseTime parses the provided value using each of the configured time
+// layouts in turn, returning the error of the first should none succeed
+func (o *options) parseTime(value string) (time.Time, error) {
+	if len(o.timeLayouts) == 0 {
+		return time.Parse(time.RFC3339, value)
+	}
+
+	var first error
+	for _, layout := range o.timeLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return time.Time{}, first
+}
@@ -0,0 +1,290 @@
+package qstring
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type OptionsQuery struct {
+	PageSize int   `form:"size"`
+	IDs      []int `form:"ids"`
+	Name     string
+	Created  time.Time
+	Tags     []string `form:"-"`
+}
+
+func TestDecoderOptions(t *testing.T) {
+	dec := NewDecoder(
+		TagName("form"),
+		KeyNaming(strings.ToUpper),
+		TimeLayouts("2006-01-02", time.RFC3339),
+		SliceDelimiter(","),
+	)
+
+	query := url.Values{
+		"size":    []string{"25"},
+		"ids":     []string{"1,2", "3"},
+		"NAME":    []string{"foo"},
+		"CREATED": []string{"2006-01-02"},
+		"tags":    []string{"ignored"},
+	}
+
+	params := &OptionsQuery{}
+	if err := dec.Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if params.PageSize != 25 || params.Name != "foo" || params.Tags != nil {
+		t.Errorf("Unexpected decoded params %+v", params)
+	}
+	if len(params.IDs) != 3 || params.IDs[0] != 1 || params.IDs[2] != 3 {
+		t.Errorf("Expected IDs [1 2 3], got %v", params.IDs)
+	}
+	if !params.Created.Equal(time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected decoded time %v", params.Created)
+	}
+
+	// the default decoder keeps using the qstring tag and lowercased names
+	params = &OptionsQuery{}
+	if err := Unmarshal(url.Values{"pagesize": []string{"5"}}, params); err != nil {
+		t.Fatal(err.Error())
+	}
+	if params.PageSize != 5 {
+		t.Errorf("Expected PageSize of 5, got %d", params.PageSize)
+	}
+}
+
+func TestEncoderOptions(t *testing.T) {
+	enc := NewEncoder(
+		TagName("form"),
+		KeyNaming(strings.ToUpper),
+		TimeLayouts("2006-01-02"),
+		SliceDelimiter(","),
+	)
+
+	params := &OptionsQuery{
+		PageSize: 25,
+		IDs:      []int{1, 2, 3},
+		Name:     "foo",
+		Created:  time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		Tags:     []string{"ignored"},
+	}
+	result, err := enc.MarshalString(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := "CREATED=2006-01-02&NAME=foo&ids=1%2C2%2C3&size=25"
+	if result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestSliceDelimiterConstraints(t *testing.T) {
+	type Query struct {
+		IDs []int `qstring:"ids,min=1"`
+	}
+
+	dec := NewDecoder(SliceDelimiter(","))
+	if err := dec.Unmarshal(url.Values{"ids": []string{"1,2", "3"}}, &Query{}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	err := dec.Unmarshal(url.Values{"ids": []string{"1", "2,0"}}, &Query{})
+	var constraintErr *ConstraintError
+	if !errors.As(err, &constraintErr) || constraintErr.Field != "IDs[2]" || constraintErr.Value != "0" {
+		t.Errorf("Expected a ConstraintError for IDs[2], got %v", err)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	var testio = []struct {
+		dec   *Decoder
+		query url.Values
+		err   error
+	}{
+		{NewDecoder(MaxSliceLength(2)), url.Values{"ids": []string{"1", "2"}}, nil},
+		{NewDecoder(MaxSliceLength(2)), url.Values{"ids": []string{"1", "2", "3"}},
+			&LimitError{Key: "ids", Limit: "slice length", Max: 2}},
+		{NewDecoder(SliceDelimiter(","), MaxSliceLength(2)), url.Values{"ids": []string{"1,2,3"}},
+			&LimitError{Key: "ids", Limit: "slice length", Max: 2}},
+		{NewDecoder(MaxParameters(1)), url.Values{"ids": []string{"1"}, "name": []string{"a"}},
+			&LimitError{Limit: "number of parameters", Max: 1}},
+	}
+
+	for _, test := range testio {
+		err := test.dec.Unmarshal(test.query, &OptionsQuery{})
+		if test.err == nil {
+			if err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			continue
+		}
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Errorf("Expected a LimitError, got %v", err)
+			continue
+		}
+		if *limitErr != *test.err.(*LimitError) {
+			t.Errorf("Expected %+v, got %+v", test.err, limitErr)
+		}
+	}
+}
+
+func TestDisallowRepeatedKeys(t *testing.T) {
+	query := url.Values{"name": []string{"foo", "bar"}, "ids": []string{"1", "2"}}
+
+	params := &OptionsQuery{}
+	if err := Unmarshal(query, params); err != nil || params.Name != "foo" {
+		t.Errorf("Expected the first value to be used, got %q (%v)", params.Name, err)
+	}
+
+	err := NewDecoder(DisallowRepeatedKeys()).Unmarshal(query, &OptionsQuery{})
+	if !errors.Is(err, ErrRepeatedKey) {
+		t.Fatalf("Expected ErrRepeatedKey, got %v", err)
+	}
+
+	var typeErr *UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Key != "name" || typeErr.Value != "bar" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestDecoderConcurrentUse(t *testing.T) {
+	dec := NewDecoder(TagName("form"), SliceDelimiter(","))
+	enc := NewEncoder(TagName("form"), SliceDelimiter(","))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			params := &OptionsQuery{}
+			if err := dec.Unmarshal(url.Values{"ids": []string{"1,2"}}, params); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := enc.Marshal(params); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTagNames(t *testing.T) {
+	type Query struct {
+		Name    string `qstring:"q" json:"name"`
+		Limit   int    `form:"per_page" json:"limit"`
+		Offset  int    `json:"offset,omitempty"`
+		Secret  string `json:"-"`
+		Created string `json:",omitempty"`
+		Page    int
+	}
+
+	opts := TagNames("qstring", "form", "json")
+	query := url.Values{
+		"q":        []string{"foo"},
+		"per_page": []string{"10"},
+		"offset":   []string{"5"},
+		"secret":   []string{"x"},
+		"created":  []string{"today"},
+		"page":     []string{"2"},
+	}
+
+	params := &Query{}
+	if err := NewDecoder(opts, DisallowUnknownKeys()).Unmarshal(query, params); err == nil {
+		t.Errorf("Expected the secret parameter to be unknown")
+	}
+	delete(query, "secret")
+	if err := NewDecoder(opts, DisallowUnknownKeys()).Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := &Query{Name: "foo", Limit: 10, Offset: 5, Created: "today", Page: 2}
+	if *params != *expected {
+		t.Errorf("Expected %+v, got %+v", expected, params)
+	}
+
+	params.Offset, params.Created, params.Secret = 0, "", "x"
+	result, err := NewEncoder(opts).MarshalString(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result != "page=2&per_page=10&q=foo" {
+		t.Errorf("Expected json options to be honoured, got %q", result)
+	}
+}
+
+func TestDelimitedSlices(t *testing.T) {
+	type Query struct {
+		IDs    []int              `qstring:"ids,comma"`
+		Names  []string           `qstring:"names,pipe"`
+		Words  []string           `qstring:"words,space"`
+		Cols   []string           `qstring:"cols,tab"`
+		Tags   []string           `qstring:"tags,multi"`
+		Sort   []string           `qstring:"sort"`
+		Fields Optional[[]string] `qstring:"fields,comma"`
+		Meta   map[string][]int   `qstring:"meta,comma"`
+	}
+
+	query := url.Values{
+		"ids":        []string{"1,2", "3"},
+		"names":      []string{`a\|b|c`},
+		"words":      []string{"hello world"},
+		"cols":       []string{"a\tb"},
+		"tags":       []string{"x;y", "z"},
+		"sort":       []string{"name;-created"},
+		"fields":     []string{"id,name"},
+		"meta[nums]": []string{"4,5"},
+	}
+
+	params := &Query{}
+	if err := NewDecoder(SliceDelimiter(";")).Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := &Query{
+		IDs:    []int{1, 2, 3},
+		Names:  []string{"a|b", "c"},
+		Words:  []string{"hello", "world"},
+		Cols:   []string{"a", "b"},
+		Tags:   []string{"x;y", "z"},
+		Sort:   []string{"name", "-created"},
+		Fields: NewOptional([]string{"id", "name"}),
+		Meta:   map[string][]int{"nums": {4, 5}},
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, params)
+	}
+
+	values, err := NewEncoder(SliceDelimiter(";")).Marshal(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expectedValues := url.Values{
+		"ids":        []string{"1,2,3"},
+		"names":      []string{`a\|b|c`},
+		"words":      []string{"hello world"},
+		"cols":       []string{"a\tb"},
+		"tags":       []string{"x;y", "z"},
+		"sort":       []string{"name;-created"},
+		"fields":     []string{"id,name"},
+		"meta[nums]": []string{"4,5"},
+	}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Errorf("Expected %q, got %q", expectedValues, values)
+	}
+
+	params = &Query{}
+	if err = Unmarshal(url.Values{"ids": []string{""}}, params); err != nil || len(params.IDs) != 0 {
+		t.Errorf("Expected an empty value to hold no elements, got %v (%v)", params.IDs, err)
+	}
+}
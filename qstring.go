@@ -2,6 +2,7 @@ package qstring
 
 const (
 	// Tag indicates the name of the struct tag to extract from provided structs
-	// when marshalling or unmarshalling
+	// when marshalling or unmarshalling, unless other tags are configured with
+	// the TagName or TagNames options
 	Tag = "qstring"
 )
@@ -0,0 +1,91 @@
+package qstring
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// EncodeFunc converts a value of a registered type into a single query
+// parameter value
+type EncodeFunc func(v interface{}) (string, error)
+
+// DecodeFunc converts a single query parameter value into a value of a
+// registered type
+type DecodeFunc func(s string) (interface{}, error)
+
+// converter holds the functions registered for a type. Either function may be
+// nil if the type is only ever marshaled or unmarshaled
+type converter struct {
+	enc EncodeFunc
+	dec DecodeFunc
+}
+
+// registry maps each globally registered type to its converter, with
+// registered counting the types it holds
+var (
+	registry   sync.Map // map[reflect.Type]converter
+	registered atomic.Int32
+)
+
+// RegisterType registers functions for converting values of typ to and from
+// query parameter values, for use by every Decoder and Encoder. Registered
+// types take precedence over the QueryValue and encoding.Text interfaces as
+// well as the built in conversions. RegisterType is intended to be called
+// during program initialization
+func RegisterType(typ reflect.Type, enc EncodeFunc, dec DecodeFunc) {
+	if _, loaded := registry.Swap(typ, converter{enc: enc, dec: dec}); !loaded {
+		registered.Add(1)
+	}
+}
+
+// TypeConverter registers functions for converting values of typ to and from
+// query parameter values for a single Decoder or Encoder, taking precedence
+// over any functions registered with RegisterType
+func TypeConverter(typ reflect.Type, enc EncodeFunc, dec DecodeFunc) Option {
+	return func(o *options) {
+		if o.converters == nil {
+			o.converters = make(map[reflect.Type]converter)
+		}
+		o.converters[typ] = converter{enc: enc, dec: dec}
+	}
+}
+
+// converter returns the converter registered for t, looking first at the
+// converters configured for this Decoder or Encoder and then the global
+// registry
+func (o *options) converter(t reflect.Type) (converter, bool) {
+	if c, ok := o.converters[t]; ok {
+		return c, true
+	}
+	if registered.Load() == 0 {
+		return converter{}, false
+	}
+	if c, ok := registry.Load(t); ok {
+		return c.(converter), true
+	}
+	return converter{}, false
+}
+
+// hasConverters reports whether any converters may apply to this Decoder or
+// Encoder, allowing the lookup to be skipped entirely when none are registered
+func (o *options) hasConverters() bool {
+	return len(o.converters) > 0 || registered.Load() > 0
+}
+
+// decodeConverted sets field to the value produced by the decode function
+// registered for its type
+func decodeConverted(dec DecodeFunc, query string, field reflect.Value) error {
+	v, err := dec(query)
+	if err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || !rv.Type().AssignableTo(field.Type()) {
+		return fmt.Errorf("qstring: decode func for %s returned %T", field.Type(), v)
+	}
+	field.Set(rv)
+	return nil
+}
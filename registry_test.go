@@ -0,0 +1,109 @@
+package qstring
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Money stands in for a third party type which has no query value methods
+type Money struct {
+	cents int64
+}
+
+func encodeMoney(v interface{}) (string, error) {
+	m := v.(Money)
+	return fmt.Sprintf("%d.%02d", m.cents/100, m.cents%100), nil
+}
+
+func decodeMoney(s string) (interface{}, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return Money{cents: int64(f*100 + 0.5)}, nil
+}
+
+type PriceQuery struct {
+	Min    Money
+	Prices []Money
+}
+
+func TestRegisterType(t *testing.T) {
+	RegisterType(reflect.TypeOf(Money{}), encodeMoney, decodeMoney)
+	defer func() {
+		registry.Delete(reflect.TypeOf(Money{}))
+		registered.Add(-1)
+	}()
+
+	query := url.Values{
+		"min":    []string{"1.50"},
+		"prices": []string{"2.25", "10"},
+	}
+
+	params := &PriceQuery{}
+	if err := Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if params.Min.cents != 150 || len(params.Prices) != 2 || params.Prices[1].cents != 1000 {
+		t.Errorf("Unexpected decoded prices %+v", params)
+	}
+
+	values, err := Marshal(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := url.Values{
+		"min":    []string{"1.50"},
+		"prices": []string{"2.25", "10.00"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %q, got %q", expected, values)
+	}
+
+	var typeErr *UnmarshalTypeError
+	err = Unmarshal(url.Values{"min": []string{"free"}}, params)
+	if !errors.As(err, &typeErr) || typeErr.Field != "Min" {
+		t.Errorf("Expected *UnmarshalTypeError for Min, got %v", err)
+	}
+}
+
+func TestTypeConverter(t *testing.T) {
+	cents := TypeConverter(reflect.TypeOf(Money{}),
+		func(v interface{}) (string, error) {
+			return strconv.FormatInt(v.(Money).cents, 10), nil
+		},
+		func(s string) (interface{}, error) {
+			c, err := strconv.ParseInt(s, 10, 64)
+			return Money{cents: c}, err
+		})
+
+	params := &PriceQuery{}
+	err := NewDecoder(cents).Unmarshal(url.Values{"min": []string{"150"}}, params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if params.Min.cents != 150 {
+		t.Errorf("Expected 150 cents, got %d", params.Min.cents)
+	}
+
+	values, err := NewEncoder(cents).Marshal(params)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if values.Get("min") != "150" {
+		t.Errorf("Expected min=150, got %q", values["min"])
+	}
+
+	// without the converter Money is treated as a nested struct
+	if values, _ = Marshal(params); values.Get("min") != "" {
+		t.Errorf("Expected converter to be scoped to its Encoder, got %q", values)
+	}
+}
@@ -1,11 +1,27 @@
 package qstring
 
 import (
+	"encoding"
+	"net/url"
 	"reflect"
 	"strings"
 	"time"
 )
 
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	comparativeTimeType = reflect.TypeOf(ComparativeTime{})
+	valuesType          = reflect.TypeOf(url.Values{})
+	stringsType         = reflect.TypeOf([]string{})
+
+	queryValueMarshalerType   = reflect.TypeOf((*QueryValueMarshaler)(nil)).Elem()
+	queryValueUnmarshalerType = reflect.TypeOf((*QueryValueUnmarshaler)(nil)).Elem()
+	textMarshalerType         = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType       = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	validatorType             = reflect.TypeOf((*Validator)(nil)).Elem()
+	marshallerType            = reflect.TypeOf((*Marshaller)(nil)).Elem()
+)
+
 // isEmptyValue returns true if the provided reflect.Value
 func isEmptyValue(v reflect.Value) bool {
 	switch v.Kind() {
@@ -22,6 +38,9 @@ func isEmptyValue(v reflect.Value) bool {
 	case reflect.Interface, reflect.Ptr:
 		return v.IsNil()
 	case reflect.Struct:
+		if isOptional(v.Type()) {
+			return !v.Field(optionalSet).Bool()
+		}
 		switch t := v.Interface().(type) {
 		case time.Time:
 			return t.IsZero()
@@ -32,15 +51,208 @@ func isEmptyValue(v reflect.Value) bool {
 	return false
 }
 
+// isQueryValue returns true if values of type t, or pointers to them, convert
+// themselves to and from a single query parameter value through either the
+// QueryValue or the encoding.Text interfaces
+func isQueryValue(t reflect.Type) bool {
+	pt := reflect.PtrTo(t)
+	return pt.Implements(queryValueMarshalerType) ||
+		pt.Implements(queryValueUnmarshalerType) ||
+		pt.Implements(textMarshalerType) ||
+		pt.Implements(textUnmarshalerType)
+}
+
+// isNestedStruct returns true if the provided type is a struct whose fields
+// should be resolved as query parameters of their own rather than coerced from
+// a single query parameter
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	switch t {
+	case timeType, comparativeTimeType:
+		return false
+	}
+	return !isOptional(t) && !isQueryValue(t)
+}
+
+// joinPath appends a field name to the provided Go field path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// splitValues splits each of the provided query parameter values on sep,
+// unescaping any delimiters and backslashes escaped with a backslash. Empty
+// values hold no elements
+func splitValues(query []string, sep string) []string {
+	var out []string
+	for _, q := range query {
+		if q != "" {
+			out = append(out, splitEscaped(q, sep)...)
+		}
+	}
+	return out
+}
+
+// splitEscaped splits s on each occurrence of sep which is not escaped with a
+// backslash, unescaping the elements
+func splitEscaped(s, sep string) []string {
+	if !strings.Contains(s, `\`) {
+		return strings.Split(s, sep)
+	}
+
+	var out []string
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '\\' && strings.HasPrefix(s[i+1:], sep):
+			b.WriteString(sep)
+			i += 1 + len(sep)
+		case s[i] == '\\' && strings.HasPrefix(s[i+1:], `\`):
+			b.WriteByte('\\')
+			i += 2
+		case strings.HasPrefix(s[i:], sep):
+			out = append(out, b.String())
+			b.Reset()
+			i += len(sep)
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return append(out, b.String())
+}
+
+// joinValues joins the provided values with sep, escaping any delimiters and
+// backslashes within them with a backslash
+func joinValues(vals []string, sep string) string {
+	var escaper *strings.Replacer
+	escaped := make([]string, len(vals))
+	for i, v := range vals {
+		if strings.Contains(v, sep) || strings.Contains(v, `\`) {
+			if escaper == nil {
+				escaper = strings.NewReplacer(`\`, `\\`, sep, `\`+sep)
+			}
+			v = escaper.Replace(v)
+		}
+		escaped[i] = v
+	}
+	return strings.Join(escaped, sep)
+}
+
+// tagOptions holds the options which follow the name in a qstring struct tag
+type tagOptions struct {
+	omitEmpty  bool
+	remain     bool
+	prefix     bool
+	required   bool
+	hasDefault bool
+	def        string
+	alias      string
+
+	// delimiter joins the elements of a slice field when hasDelimiter is set,
+	// with an empty delimiter denoting repeated keys
+	delimiter    string
+	hasDelimiter bool
+
+	deprecated  bool
+	deprecation string
+
+	// validation options, left empty when not provided
+	min, max       string
+	minLen, maxLen string
+	pattern        string
+	oneOf          string
+}
+
 // parseTag splits a struct field's qstring tag into its name and, if an
 // optional omitempty option was provided, a boolean indicating this is
 // returned
 func parseTag(tag string) (string, bool) {
-	if idx := strings.Index(tag, ","); idx != -1 {
-		if tag[idx+1:] == "omitempty" {
-			return tag[:idx], true
+	name, opts := parseTagOptions(tag)
+	return name, opts.omitEmpty
+}
+
+// delimiters maps the collection format tag options to the delimiter joining
+// the elements of a slice field
+var delimiters = map[string]string{
+	"comma": ",",
+	"pipe":  "|",
+	"space": " ",
+	"tab":   "\t",
+	"multi": "",
+}
+
+// parseTagOptions splits a struct field's qstring tag into its name and the
+// comma separated options that follow it. Unrecognised options are ignored.
+// As a regular expression may itself contain commas, the pattern option
+// consumes the remainder of the tag and must therefore be the last option
+func parseTagOptions(tag string) (string, tagOptions) {
+	var opts tagOptions
+	name, rest, _ := strings.Cut(tag, ",")
+	for rest != "" {
+		var opt string
+		opt, rest, _ = strings.Cut(rest, ",")
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "omitempty":
+			opts.omitEmpty = true
+		case "remain":
+			opts.remain = true
+		case "prefix":
+			opts.prefix = true
+		case "comma", "pipe", "space", "tab", "multi":
+			opts.hasDelimiter = true
+			opts.delimiter = delimiters[key]
+		case "required":
+			opts.required = true
+		case "default":
+			opts.hasDefault = true
+			opts.def = value
+		case "alias":
+			opts.alias = value
+		case "deprecated":
+			opts.deprecated = true
+			opts.deprecation = value
+		case "min":
+			opts.min = value
+		case "max":
+			opts.max = value
+		case "minlen":
+			opts.minLen = value
+		case "maxlen":
+			opts.maxLen = value
+		case "oneof":
+			opts.oneOf = value
+		case "pattern":
+			opts.pattern = value
+			if rest != "" {
+				opts.pattern += "," + rest
+				rest = ""
+			}
 		}
-		return tag[:idx], false
 	}
-	return tag, false
+	return name, opts
+}
+
+// isMapField returns true if the provided type is a map keyed by strings whose
+// values are single values or slices of them, rather than nested structs
+func isMapField(t reflect.Type) bool {
+	if t.Kind() != reflect.Map || t.Key().Kind() != reflect.String {
+		return false
+	}
+	elem := t.Elem()
+	if elem.Kind() == reflect.Slice && !isQueryValue(elem) {
+		elem = elem.Elem()
+	}
+	return !isNestedStruct(indirectType(elem)) && !isOptional(elem)
+}
+
+// isRemainField returns true if a field tagged with the remain option is able
+// to hold the leftover query parameters
+func isRemainField(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && valuesType.ConvertibleTo(t)
 }
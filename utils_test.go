@@ -95,3 +95,69 @@ func TestOmitEmpty(t *testing.T) {
 		}
 	}
 }
+
+func TestTagOptionsParsing(t *testing.T) {
+	testio := []struct {
+		inp    string
+		output string
+		opts   tagOptions
+	}{
+		{inp: "name,omitempty", output: "name", opts: tagOptions{omitEmpty: true}},
+		{inp: ",remain", output: "", opts: tagOptions{remain: true}},
+		{inp: "name,remain,omitempty", output: "name",
+			opts: tagOptions{omitEmpty: true, remain: true}},
+		{inp: "name,unknown", output: "name", opts: tagOptions{}},
+		{inp: "page,prefix", output: "page", opts: tagOptions{prefix: true}},
+		{inp: "ids,pipe", output: "ids",
+			opts: tagOptions{delimiter: "|", hasDelimiter: true}},
+		{inp: "ids,multi", output: "ids", opts: tagOptions{hasDelimiter: true}},
+		{inp: "limit,alias=per_page|count,omitempty", output: "limit",
+			opts: tagOptions{alias: "per_page|count", omitEmpty: true}},
+		{inp: "page,deprecated", output: "page", opts: tagOptions{deprecated: true}},
+		{inp: "page,deprecated=use offset", output: "page",
+			opts: tagOptions{deprecated: true, deprecation: "use offset"}},
+	}
+
+	for _, test := range testio {
+		name, opts := parseTagOptions(test.inp)
+		if name != test.output {
+			t.Errorf("Expected tag name to be %q, got %q instead", test.output, name)
+		}
+
+		if !reflect.DeepEqual(opts, test.opts) {
+			t.Errorf("Expected options %+v for %q, got %+v instead", test.opts, test.inp, opts)
+		}
+	}
+}
+
+func TestSplitJoinValues(t *testing.T) {
+	testio := []struct {
+		sep    string
+		vals   []string
+		joined string
+	}{
+		{",", []string{"a", "b", "c"}, "a,b,c"},
+		{",", []string{"a,b", "c"}, `a\,b,c`},
+		{",", []string{`a\b`, `c\`}, `a\\b,c\\`},
+		{"|", []string{"a|b", "a,b"}, `a\|b|a,b`},
+		{" ", []string{"a b", ""}, `a\ b `},
+		{"\t", []string{"a", "b"}, "a\tb"},
+	}
+
+	for _, test := range testio {
+		joined := joinValues(test.vals, test.sep)
+		if joined != test.joined {
+			t.Errorf("Expected %v to be joined as %q, got %q", test.vals, test.joined, joined)
+		}
+
+		split := splitValues([]string{joined}, test.sep)
+		if !reflect.DeepEqual(split, test.vals) {
+			t.Errorf("Expected %q to be split into %q, got %q", joined, test.vals, split)
+		}
+	}
+
+	// backslashes which escape neither a delimiter nor a backslash are kept
+	if split := splitValues([]string{`a\b,c`, ""}, ","); !reflect.DeepEqual(split, []string{`a\b`, "c"}) {
+		t.Errorf("Unexpected split %q", split)
+	}
+}
@@ -0,0 +1,208 @@
+package qstring
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A ConstraintError describes a query parameter whose value violates one of
+// the validation options declared in its struct tag
+type ConstraintError struct {
+	Key        string // query parameter key
+	Field      string // Go field path, e.g. "PageInfo.Limit" or "IDs[1]"
+	Constraint string // violated tag option, e.g. "max=100"
+	Value      string // raw query parameter value
+}
+
+func (e *ConstraintError) Error() string {
+	return "qstring: parameter " + strconv.Quote(e.Key) + " value " +
+		strconv.Quote(e.Value) + " violates " + e.Constraint
+}
+
+// rule is a validation option compiled from a struct tag
+type rule struct {
+	constraint string
+
+	// each indicates the rule applies to every element of a slice field
+	// rather than to the slice as a whole
+	each bool
+
+	// check reports whether the raw query value and the value it was coerced
+	// into satisfy the rule
+	check func(raw string, v reflect.Value) bool
+}
+
+// compileRules builds the validation rules declared by the provided tag options
+// for a field of type t. The rules which apply to each element are applied to
+// the elements of t when slice is set, being true for fields coerced from each
+// of their query parameter values rather than a single one
+func compileRules(t reflect.Type, opts tagOptions, slice bool) ([]rule, error) {
+	var rules []rule
+	t = valueType(t)
+	elemType := t
+	if slice {
+		elemType = indirectType(t.Elem())
+	}
+
+	for _, bound := range []struct {
+		option, arg string
+		cmp         func(a, b float64) bool
+	}{
+		{"min", opts.min, func(v, min float64) bool { return v >= min }},
+		{"max", opts.max, func(v, max float64) bool { return v <= max }},
+	} {
+		if bound.arg == "" {
+			continue
+		}
+		if !isNumeric(elemType.Kind()) {
+			return nil, fmt.Errorf("qstring: %s option requires a numeric field, got %s", bound.option, t)
+		}
+		limit, err := strconv.ParseFloat(bound.arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("qstring: invalid %s option %q: %v", bound.option, bound.arg, err)
+		}
+		cmp := bound.cmp
+		rules = append(rules, rule{
+			constraint: bound.option + "=" + bound.arg,
+			each:       true,
+			check: func(_ string, v reflect.Value) bool {
+				return cmp(numericValue(v), limit)
+			},
+		})
+	}
+
+	for _, bound := range []struct {
+		option, arg string
+		cmp         func(a, b int) bool
+	}{
+		{"minlen", opts.minLen, func(l, min int) bool { return l >= min }},
+		{"maxlen", opts.maxLen, func(l, max int) bool { return l <= max }},
+	} {
+		if bound.arg == "" {
+			continue
+		}
+		if t.Kind() != reflect.String && t.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("qstring: %s option requires a string or slice field, got %s", bound.option, t)
+		}
+		limit, err := strconv.Atoi(bound.arg)
+		if err != nil {
+			return nil, fmt.Errorf("qstring: invalid %s option %q: %v", bound.option, bound.arg, err)
+		}
+		cmp := bound.cmp
+		rules = append(rules, rule{
+			constraint: bound.option + "=" + bound.arg,
+			check: func(_ string, v reflect.Value) bool {
+				if v.Kind() == reflect.String {
+					return cmp(utf8.RuneCountInString(v.String()), limit)
+				}
+				return cmp(v.Len(), limit)
+			},
+		})
+	}
+
+	if opts.pattern != "" {
+		re, err := regexp.Compile(opts.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("qstring: invalid pattern option %q: %v", opts.pattern, err)
+		}
+		rules = append(rules, rule{
+			constraint: "pattern=" + opts.pattern,
+			each:       true,
+			check: func(raw string, _ reflect.Value) bool {
+				return re.MatchString(raw)
+			},
+		})
+	}
+
+	if opts.oneOf != "" {
+		allowed := strings.Split(opts.oneOf, "|")
+		rules = append(rules, rule{
+			constraint: "oneof=" + opts.oneOf,
+			each:       true,
+			check: func(raw string, _ reflect.Value) bool {
+				for _, a := range allowed {
+					if raw == a {
+						return true
+					}
+				}
+				return false
+			},
+		})
+	}
+	return rules, nil
+}
+
+// validate checks the coerced field against each of the rules declared in its
+// tag, returning a ConstraintError for the first violation found. The rules
+// which apply to each element are applied to every element when slice is set
+func validate(rules []rule, slice bool, key, path string, query []string, field reflect.Value) error {
+	field = reflect.Indirect(field)
+	if isOptional(field.Type()) {
+		// an empty Optional holds no value to be validated
+		if field.Field(optionalEmpty).Bool() {
+			return nil
+		}
+		field = reflect.Indirect(field.Field(optionalValue))
+	}
+
+	for _, r := range rules {
+		if !r.each || !slice {
+			// fields holding a single value are coerced from the first
+			// query parameter value alone
+			raw := firstValue(query)
+			if slice {
+				raw = strings.Join(query, ",")
+			}
+			if !r.check(raw, field) {
+				return &ConstraintError{Key: key, Field: path, Constraint: r.constraint, Value: raw}
+			}
+			continue
+		}
+
+		for i := 0; i < field.Len(); i++ {
+			if !r.check(query[i], reflect.Indirect(field.Index(i))) {
+				return &ConstraintError{
+					Key:        key,
+					Field:      path + "[" + strconv.Itoa(i) + "]",
+					Constraint: r.constraint,
+					Value:      query[i],
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// indirectType returns the type pointed at by t if t is a pointer type
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// isNumeric returns true for the integer, unsigned integer and float kinds
+func isNumeric(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// numericValue returns the value of a numeric reflect.Value as a float64
+func numericValue(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
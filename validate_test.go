@@ -0,0 +1,233 @@
+package qstring
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalConstraints(t *testing.T) {
+	type Query struct {
+		Limit  int      `qstring:"limit,min=1,max=100"`
+		Ratio  float64  `qstring:"ratio,max=0.5"`
+		Name   string   `qstring:"name,minlen=2,maxlen=5"`
+		Tags   []string `qstring:"tags,maxlen=2"`
+		Sort   string   `qstring:"sort,oneof=name|created"`
+		IDs    []uint   `qstring:"ids,max=10"`
+		Search string   `qstring:"q,pattern=^[a-z]{1,3}$"`
+	}
+
+	testio := []struct {
+		inp        url.Values
+		key        string
+		field      string
+		constraint string
+	}{
+		{inp: url.Values{"limit": []string{"0"}}, key: "limit", field: "Limit",
+			constraint: "min=1"},
+		{inp: url.Values{"limit": []string{"500"}}, key: "limit", field: "Limit",
+			constraint: "max=100"},
+		{inp: url.Values{"ratio": []string{"0.75"}}, key: "ratio", field: "Ratio",
+			constraint: "max=0.5"},
+		{inp: url.Values{"name": []string{"a"}}, key: "name", field: "Name",
+			constraint: "minlen=2"},
+		{inp: url.Values{"name": []string{"abcdef"}}, key: "name", field: "Name",
+			constraint: "maxlen=5"},
+		{inp: url.Values{"tags": []string{"a", "b", "c"}}, key: "tags",
+			field: "Tags", constraint: "maxlen=2"},
+		{inp: url.Values{"sort": []string{"size"}}, key: "sort", field: "Sort",
+			constraint: "oneof=name|created"},
+		{inp: url.Values{"ids": []string{"1", "11"}}, key: "ids", field: "IDs[1]",
+			constraint: "max=10"},
+		{inp: url.Values{"q": []string{"abcd"}}, key: "q", field: "Search",
+			constraint: "pattern=^[a-z]{1,3}$"},
+	}
+
+	for _, test := range testio {
+		err := Unmarshal(test.inp, &Query{})
+		var constraintErr *ConstraintError
+		if !errors.As(err, &constraintErr) {
+			t.Errorf("Expected *ConstraintError for %q, got %v", test.inp, err)
+			continue
+		}
+
+		if constraintErr.Key != test.key || constraintErr.Field != test.field ||
+			constraintErr.Constraint != test.constraint {
+			t.Errorf("Expected %q, %q and %q, got %q, %q and %q", test.key,
+				test.field, test.constraint, constraintErr.Key,
+				constraintErr.Field, constraintErr.Constraint)
+		}
+	}
+
+	valid := url.Values{
+		"limit": []string{"50"},
+		"ratio": []string{"0.5"},
+		"name":  []string{"abc"},
+		"tags":  []string{"a", "b"},
+		"sort":  []string{"created"},
+		"ids":   []string{"1", "10"},
+		"q":     []string{"abc"},
+	}
+	if err := Unmarshal(valid, &Query{}); err != nil {
+		t.Errorf("Expected valid query to pass validation, got %v", err)
+	}
+}
+
+func TestInvalidConstraintTags(t *testing.T) {
+	type BadMin struct {
+		Name string `qstring:"name,min=1"`
+	}
+
+	type BadPattern struct {
+		Name string `qstring:"name,pattern=["`
+	}
+
+	for _, v := range []interface{}{&BadMin{}, &BadPattern{}} {
+		if err := Unmarshal(url.Values{}, v); err == nil {
+			t.Errorf("Expected invalid tag error for %T", v)
+		}
+	}
+}
+
+var errRange = errors.New("start must be before end")
+
+type RangeQuery struct {
+	Start int
+	End   int
+}
+
+func (r *RangeQuery) ValidateQuery() error {
+	if r.Start > r.End {
+		return errRange
+	}
+	return nil
+}
+
+type NestedRangeQuery struct {
+	Range RangeQuery
+	Name  string
+}
+
+func TestValidator(t *testing.T) {
+	testio := []struct {
+		inp   url.Values
+		v     interface{}
+		field string
+	}{
+		{inp: url.Values{"start": []string{"5"}, "end": []string{"1"}},
+			v: &RangeQuery{}, field: ""},
+		{inp: url.Values{"start": []string{"5"}, "end": []string{"1"}},
+			v: &NestedRangeQuery{}, field: "Range"},
+	}
+
+	for _, test := range testio {
+		err := Unmarshal(test.inp, test.v)
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("Expected *ValidationError, got %v", err)
+			continue
+		}
+
+		if validationErr.Field != test.field {
+			t.Errorf("Expected field %q, got %q", test.field, validationErr.Field)
+		}
+
+		if !errors.Is(err, errRange) {
+			t.Errorf("Expected %v to wrap %v", err, errRange)
+		}
+	}
+
+	valid := url.Values{"start": []string{"1"}, "end": []string{"5"}}
+	if err := Unmarshal(valid, &NestedRangeQuery{}); err != nil {
+		t.Errorf("Expected valid range to pass, got %v", err)
+	}
+
+	// the hook isn't run against a struct whose fields failed to decode
+	invalid := url.Values{"start": []string{"x"}, "end": []string{"1"}}
+	err := UnmarshalAll(invalid, &RangeQuery{})
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		t.Errorf("Expected validation hook to be skipped, got %v", err)
+	}
+}
+
+// CSV is a slice type unmarshaled from a single comma separated value
+type CSV []string
+
+func (c *CSV) UnmarshalText(text []byte) error {
+	*c = strings.Split(string(text), ",")
+	return nil
+}
+
+func TestSingleValueSliceConstraints(t *testing.T) {
+	type Query struct {
+		IP   net.IP `qstring:"ip,pattern=^[0-9.]+$"`
+		Tags CSV    `qstring:"tags,pattern=^[a-z]+(,[a-z]+)*$"`
+	}
+
+	params := &Query{}
+	query := url.Values{"ip": []string{"10.0.0.1"}, "tags": []string{"a,b"}}
+	if err := Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+	if params.IP.String() != "10.0.0.1" || len(params.Tags) != 2 {
+		t.Errorf("Unexpected params %+v", params)
+	}
+
+	var constraintErr *ConstraintError
+	err := Unmarshal(url.Values{"ip": []string{"::1"}}, &Query{})
+	if !errors.As(err, &constraintErr) || constraintErr.Field != "IP" || constraintErr.Value != "::1" {
+		t.Errorf("Expected a ConstraintError for IP, got %v", err)
+	}
+}
+
+func TestRepeatedKeyConstraints(t *testing.T) {
+	type Query struct {
+		Sort string `qstring:"sort,oneof=asc|desc"`
+		One  string `qstring:"one,pattern=^[a-z]+$"`
+	}
+
+	params := &Query{}
+	query := url.Values{"sort": []string{"asc", "asc"}, "one": []string{"abc", "x y"}}
+	if err := Unmarshal(query, params); err != nil {
+		t.Fatalf("Expected only the decoded values to be validated, got %v", err)
+	}
+	if params.Sort != "asc" || params.One != "abc" {
+		t.Errorf("Unexpected params %+v", params)
+	}
+
+	var constraintErr *ConstraintError
+	err := Unmarshal(url.Values{"sort": []string{"up", "asc"}}, &Query{})
+	if !errors.As(err, &constraintErr) || constraintErr.Value != "up" {
+		t.Errorf("Expected a ConstraintError for value up, got %v", err)
+	}
+}
+
+func TestMapConstraints(t *testing.T) {
+	type Query struct {
+		Meta map[string]int      `qstring:"meta,max=5"`
+		Tags map[string][]string `qstring:"tags,oneof=a|b"`
+	}
+
+	params := &Query{}
+	query := url.Values{"meta[x]": []string{"3"}, "tags[t]": []string{"a", "b"}}
+	if err := Unmarshal(query, params); err != nil {
+		t.Fatal(err.Error())
+	}
+	if params.Meta["x"] != 3 || len(params.Tags["t"]) != 2 {
+		t.Errorf("Unexpected params %+v", params)
+	}
+
+	var constraintErr *ConstraintError
+	err := Unmarshal(url.Values{"meta[y]": []string{"6"}}, &Query{})
+	if !errors.As(err, &constraintErr) || constraintErr.Key != "meta[y]" || constraintErr.Field != `Meta["y"]` {
+		t.Errorf("Expected a ConstraintError for meta[y], got %v", err)
+	}
+
+	err = Unmarshal(url.Values{"tags[t]": []string{"a", "c"}}, &Query{})
+	if !errors.As(err, &constraintErr) || constraintErr.Field != `Tags["t"][1]` {
+		t.Errorf("Expected a ConstraintError for tags[t], got %v", err)
+	}
+}